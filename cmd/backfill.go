@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/firebolt-db/otel-exporter/internal/collector"
+	"github.com/firebolt-db/otel-exporter/internal/fetcher"
+)
+
+// backfillCommand creates a cli command, which replays the metrics of a past time range.
+func (a *app) backfillCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "backfill",
+		Usage: "Collects and exports the metrics of a past time range, then exits.",
+		Flags: []cli.Flag{
+			&cli.TimestampFlag{
+				Name:     "from",
+				Usage:    "start of the time range, in RFC3339 format",
+				Layout:   time.RFC3339,
+				Required: true,
+			},
+			&cli.TimestampFlag{
+				Name:   "to",
+				Usage:  "end of the time range, in RFC3339 format (default: now)",
+				Layout: time.RFC3339,
+			},
+			&cli.DurationFlag{
+				Name:  "step",
+				Usage: "size of the windows the time range is collected in (default: collect interval)",
+			},
+		},
+		Action: a.backfill,
+	}
+}
+
+// backfill is a running function of the backfill command
+func (a *app) backfill(cliCtx *cli.Context) error {
+	ctx := cliCtx.Context
+
+	from := cliCtx.Timestamp("from").UTC()
+
+	to := time.Now().UTC()
+	if cliCtx.IsSet("to") {
+		to = cliCtx.Timestamp("to").UTC()
+	}
+
+	step := a.cfg.CollectInterval
+	if cliCtx.IsSet("step") {
+		step = cliCtx.Duration("step")
+	}
+
+	if !from.Before(to) {
+		return fmt.Errorf("--from must be before --to")
+	}
+	if to.After(time.Now()) {
+		return fmt.Errorf("--to must not be in the future")
+	}
+	if step <= 0 {
+		return fmt.Errorf("--step must be positive")
+	}
+
+	slog.InfoContext(ctx, "starting firebolt opentelemetry exporter backfill",
+		slog.Time("from", from), slog.Time("to", to), slog.Duration("step", step),
+	)
+
+	f := fetcher.New(a.cfg.Credentials.ClientID, a.cfg.Credentials.ClientSecret,
+		fetcher.WithAllRuntimeSamples(a.cfg.RuntimeAllSamples),
+		fetcher.WithQueryLabel(a.cfg.QueryLabel),
+		fetcher.WithEngineTimeout(a.cfg.EngineTimeout),
+		fetcher.WithMaxConnections(a.cfg.MaxConnections),
+	)
+	slog.DebugContext(ctx, "fetcher initialized")
+
+	defer func() {
+		if err := f.Close(); err != nil {
+			slog.Error("failed to close fetcher", slog.Any("error", err))
+		}
+	}()
+
+	exp, err := a.newExporter(ctx)
+	if err != nil {
+		return err
+	}
+
+	logExp, err := a.newLogExporter(ctx)
+	if err != nil {
+		return err
+	}
+
+	spanExp, err := a.newSpanExporter(ctx)
+	if err != nil {
+		return err
+	}
+
+	classifier, err := errorClassifier(a.cfg.ErrorRulesFile)
+	if err != nil {
+		return err
+	}
+
+	slowQueryRules, err := slowQueries(a.cfg.SlowQueries)
+	if err != nil {
+		return err
+	}
+
+	// The queries of a past time range are already finished, so the query history doesn't need to be read
+	// with a lookback. The progress is not persisted, so that the backfill doesn't affect the regular collection.
+	col, err := collector.NewCollector(f, a.cfg.Accounts,
+		collector.WithExporter(exp),
+		collector.WithErrorClassifier(classifier),
+		collector.WithQueryLabels(queryLabels(a.cfg.QueryLabels)),
+		collector.WithQueryFingerprintsTopK(a.cfg.QueryFingerprintsTopK),
+		collector.WithLogExporter(logExp),
+		collector.WithQueryLogs(queryLogs(a.cfg.QueryLogs)),
+		collector.WithSlowQueries(slowQueryRules),
+		collector.WithQuerySpans(spanExp),
+		collector.WithRuntimeWindowAggregates(a.cfg.RuntimeAllSamples),
+		collector.WithExporterQueries(a.cfg.IncludeExporterQueries),
+		collector.WithCycleTimeout(a.cfg.CycleTimeout),
+		collector.WithAccountConcurrency(a.cfg.AccountConcurrency),
+		collector.WithRuntimeSchedule(schedule(a.cfg.Runtime)),
+		collector.WithQueryHistorySchedule(schedule(a.cfg.QueryHistory)),
+		collector.WithMaxCatchUp(max(a.cfg.MaxCatchUp, step)),
+	)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to initialize metrics collector", slog.Any("error", err))
+		return err
+	}
+
+	defer func() {
+		if err := col.Close(ctx); err != nil {
+			slog.Error("failed to close collector", slog.Any("error", err))
+		}
+	}()
+
+	return col.Backfill(ctx, from, to, step)
+}
@@ -1,18 +1,26 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"os"
+	"regexp"
 
 	"github.com/urfave/cli/v2"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
 	"go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 
 	"github.com/firebolt-db/otel-exporter/internal/collector"
 	"github.com/firebolt-db/otel-exporter/internal/config"
+	"github.com/firebolt-db/otel-exporter/internal/errorclass"
 	"github.com/firebolt-db/otel-exporter/internal/exporter/grpcexporter"
 	"github.com/firebolt-db/otel-exporter/internal/exporter/httpexporter"
 	"github.com/firebolt-db/otel-exporter/internal/fetcher"
 	"github.com/firebolt-db/otel-exporter/internal/logging"
+	"github.com/firebolt-db/otel-exporter/internal/slowquery"
+	"github.com/firebolt-db/otel-exporter/internal/state"
 )
 
 type app struct {
@@ -31,6 +39,9 @@ func NewApp() *cli.App {
 		Usage:   "The CLI app that starts Firebolt Open Telemetry Exporter.",
 		Before:  a.before,
 		Action:  a.run,
+		Commands: []*cli.Command{
+			a.backfillCommand(),
+		},
 	}
 
 	return a.inner
@@ -47,6 +58,9 @@ func (a *app) before(cliCtx *cli.Context) error {
 	// initialize logging
 	logging.Init(cfg.Logging)
 
+	// identify the exporter in the requests to Firebolt
+	setUserAgent()
+
 	a.cfg = cfg
 
 	return nil
@@ -55,31 +69,76 @@ func (a *app) before(cliCtx *cli.Context) error {
 // run is a main running function
 func (a *app) run(cliCtx *cli.Context) error {
 	ctx := cliCtx.Context
-	var err error
 
 	slog.DebugContext(ctx, "starting firebolt opentelemetry exporter")
 
-	f := fetcher.New(a.cfg.Credentials.ClientID, a.cfg.Credentials.ClientSecret)
+	f := fetcher.New(a.cfg.Credentials.ClientID, a.cfg.Credentials.ClientSecret,
+		fetcher.WithAllRuntimeSamples(a.cfg.RuntimeAllSamples),
+		fetcher.WithQueryLabel(a.cfg.QueryLabel),
+		fetcher.WithEngineTimeout(a.cfg.EngineTimeout),
+		fetcher.WithMaxConnections(a.cfg.MaxConnections),
+	)
 	slog.DebugContext(ctx, "fetcher initialized")
 
-	// Instantiate otel exporter.
-	// Depending on the configuration, this should be either GRPC or HTTP exporter, but one of these is required.
-	var exp metric.Exporter
-	if a.cfg.Exporter.GRPC != nil {
-		exp, err = grpcexporter.NewGRPCExporter(ctx, a.cfg.Exporter.GRPC)
-	} else {
-		exp, err = httpexporter.NewHTTPExporter(ctx, a.cfg.Exporter.HTTP)
+	defer func() {
+		if err := f.Close(); err != nil {
+			slog.Error("failed to close fetcher", slog.Any("error", err))
+		}
+	}()
+
+	exp, err := a.newExporter(ctx)
+	if err != nil {
+		return err
 	}
 
+	logExp, err := a.newLogExporter(ctx)
 	if err != nil {
-		slog.ErrorContext(ctx, "failed to initialize metrics exporter", slog.Any("error", err))
 		return err
 	}
 
-	slog.DebugContext(ctx, "exporter initialized")
+	spanExp, err := a.newSpanExporter(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Query history collection progress is kept in a file, if configured, so that it survives restarts.
+	stateStore := state.NewMemoryStore()
+	if a.cfg.StateFile != "" {
+		stateStore = state.NewFileStore(a.cfg.StateFile)
+	}
+
+	classifier, err := errorClassifier(a.cfg.ErrorRulesFile)
+	if err != nil {
+		return err
+	}
+
+	slowQueryRules, err := slowQueries(a.cfg.SlowQueries)
+	if err != nil {
+		return err
+	}
 
 	// Initialize collector, which will collect metrics and push them using exporter provided
-	col, err := collector.NewCollector(f, a.cfg.Accounts, collector.WithExporter(exp))
+	col, err := collector.NewCollector(f, a.cfg.Accounts,
+		collector.WithExporter(exp),
+		collector.WithErrorClassifier(classifier),
+		collector.WithQueryLabels(queryLabels(a.cfg.QueryLabels)),
+		collector.WithQueryFingerprintsTopK(a.cfg.QueryFingerprintsTopK),
+		collector.WithLogExporter(logExp),
+		collector.WithQueryLogs(queryLogs(a.cfg.QueryLogs)),
+		collector.WithSlowQueries(slowQueryRules),
+		collector.WithQuerySpans(spanExp),
+		collector.WithQueryHistoryLookback(a.cfg.QueryHistoryLookback),
+		collector.WithStateStore(stateStore),
+		collector.WithRuntimeWindowAggregates(a.cfg.RuntimeAllSamples),
+		collector.WithExporterQueries(a.cfg.IncludeExporterQueries),
+		collector.WithCycleTimeout(a.cfg.CycleTimeout),
+		collector.WithAccountConcurrency(a.cfg.AccountConcurrency),
+		collector.WithOverrunPolicy(a.cfg.OverrunPolicy),
+		collector.WithServerTime(a.cfg.ServerTime),
+		collector.WithRuntimeSchedule(schedule(a.cfg.Runtime)),
+		collector.WithQueryHistorySchedule(schedule(a.cfg.QueryHistory)),
+		collector.WithMaxCatchUp(a.cfg.MaxCatchUp),
+	)
 	if err != nil {
 		slog.ErrorContext(ctx, "failed to initialize metrics collector", slog.Any("error", err))
 		return err
@@ -95,3 +154,172 @@ func (a *app) run(cliCtx *cli.Context) error {
 	// start the regular collecting routine
 	return col.Start(ctx, a.cfg.CollectInterval)
 }
+
+// newExporter instantiates otel exporter.
+// Depending on the configuration, this should be either GRPC or HTTP exporter, but one of these is required.
+func (a *app) newExporter(ctx context.Context) (metric.Exporter, error) {
+	var exp metric.Exporter
+	var err error
+	if a.cfg.Exporter.GRPC != nil {
+		exp, err = grpcexporter.NewGRPCExporter(ctx, a.cfg.Exporter.GRPC)
+	} else {
+		exp, err = httpexporter.NewHTTPExporter(ctx, a.cfg.Exporter.HTTP)
+	}
+
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to initialize metrics exporter", slog.Any("error", err))
+		return nil, err
+	}
+
+	slog.DebugContext(ctx, "exporter initialized")
+
+	return exp, nil
+}
+
+// newLogExporter instantiates otel log exporter, which uses the same settings as the metrics exporter.
+// It returns nil, if neither the query logs nor the slow query log records are enabled.
+func (a *app) newLogExporter(ctx context.Context) (sdklog.Exporter, error) {
+	slowQueryLogs := a.cfg.SlowQueries.Enabled && a.cfg.SlowQueries.Output == config.SlowQueriesOutputLog
+	if !a.cfg.QueryLogs.Enabled && !slowQueryLogs {
+		return nil, nil
+	}
+
+	var exp sdklog.Exporter
+	var err error
+	if a.cfg.Exporter.GRPC != nil {
+		exp, err = grpcexporter.NewGRPCLogExporter(ctx, a.cfg.Exporter.GRPC)
+	} else {
+		exp, err = httpexporter.NewHTTPLogExporter(ctx, a.cfg.Exporter.HTTP)
+	}
+
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to initialize logs exporter", slog.Any("error", err))
+		return nil, err
+	}
+
+	slog.DebugContext(ctx, "logs exporter initialized")
+
+	return exp, nil
+}
+
+// newSpanExporter instantiates otel span exporter, which uses the same settings as the metrics exporter.
+// It returns nil, if the query spans are disabled.
+func (a *app) newSpanExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	if !a.cfg.QuerySpans {
+		return nil, nil
+	}
+
+	var exp sdktrace.SpanExporter
+	var err error
+	if a.cfg.Exporter.GRPC != nil {
+		exp, err = grpcexporter.NewGRPCTraceExporter(ctx, a.cfg.Exporter.GRPC)
+	} else {
+		exp, err = httpexporter.NewHTTPTraceExporter(ctx, a.cfg.Exporter.HTTP)
+	}
+
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to initialize traces exporter", slog.Any("error", err))
+		return nil, err
+	}
+
+	slog.DebugContext(ctx, "traces exporter initialized")
+
+	return exp, nil
+}
+
+// queryLogs returns the settings of the collector, which emit the queries as log records.
+func queryLogs(cfg config.QueryLogsConfig) collector.QueryLogs {
+	return collector.QueryLogs{
+		Enabled:         cfg.Enabled,
+		QueryTextLength: cfg.QueryTextLength,
+		RedactQueryText: cfg.Redact,
+	}
+}
+
+// slowQueries returns the collector reporting of the slow queries. The thresholds of the engines and users,
+// and the redaction patterns, are read from the rules file, if it's set.
+func slowQueries(cfg config.SlowQueriesConfig) (collector.SlowQueries, error) {
+	defaults := slowquery.Thresholds{
+		Duration:     cfg.Duration,
+		QueueTime:    cfg.QueueTime,
+		ScannedBytes: cfg.ScannedBytes,
+	}
+
+	slowQueries := collector.SlowQueries{
+		Enabled: cfg.Enabled,
+		Rules:   slowquery.Rules{Default: defaults},
+	}
+
+	if cfg.Enabled && cfg.RulesFile != "" {
+		rules, err := slowquery.LoadRules(cfg.RulesFile, defaults)
+		if err != nil {
+			return slowQueries, err
+		}
+
+		slowQueries.Rules = rules
+	}
+
+	if cfg.Output == config.SlowQueriesOutputStdout {
+		slowQueries.Writer = os.Stdout
+	}
+
+	return slowQueries, nil
+}
+
+// userAgentEnv is the environment variable, which the firebolt driver reads the client name of its user agent from.
+// The driver accepts the user agent neither in its connection string nor in its connector.
+const userAgentEnv = "FIREBOLT_GO_CLIENTS"
+
+// setUserAgent makes the firebolt driver add the client name of the exporter to the user agent of its requests,
+// unless another one is already set in the environment. It's called once at startup, before any connection is opened.
+func setUserAgent() {
+	if _, ok := os.LookupEnv(userAgentEnv); ok {
+		return
+	}
+
+	if err := os.Setenv(userAgentEnv, "FireboltOtelExporter/"+collector.Version); err != nil {
+		slog.Warn("failed to set user agent", slog.Any("error", err))
+	}
+}
+
+// errorClassifier returns the classifier of the error messages, which applies the rules of provided file,
+// if any, before the default ones.
+func errorClassifier(rulesFile string) (*errorclass.Classifier, error) {
+	rules := errorclass.DefaultRules()
+
+	if rulesFile != "" {
+		fileRules, err := errorclass.LoadRules(rulesFile)
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(fileRules, rules...)
+	}
+
+	return errorclass.NewClassifier(rules...), nil
+}
+
+// queryLabels returns the collector reporting of the query labels.
+func queryLabels(cfg config.QueryLabelsConfig) collector.QueryLabels {
+	labels := collector.QueryLabels{
+		Enabled: cfg.Enabled,
+		Allow:   cfg.Allow,
+		Limit:   cfg.Limit,
+	}
+
+	// the pattern is already validated by the config.
+	if cfg.Pattern != "" {
+		labels.Pattern = regexp.MustCompile(cfg.Pattern)
+	}
+
+	return labels
+}
+
+// schedule returns the collector schedule of a source of the metrics.
+func schedule(cfg config.SourceConfig) collector.Schedule {
+	return collector.Schedule{
+		Enabled:  cfg.Enabled,
+		Interval: cfg.Interval,
+		Offset:   cfg.Offset,
+	}
+}
@@ -0,0 +1,79 @@
+package collector
+
+import (
+	"database/sql"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/firebolt-db/otel-exporter/internal/fetcher"
+)
+
+// windowStats aggregates the values of a single runtime metric within the collection window.
+type windowStats struct {
+	min, max, sum float64
+	count         int
+}
+
+// add adds the value to the aggregate, unless it's NULL.
+func (s *windowStats) add(value sql.NullFloat64) {
+	if !value.Valid {
+		return
+	}
+
+	if s.count == 0 {
+		s.min, s.max = value.Float64, value.Float64
+	}
+
+	s.min = min(s.min, value.Float64)
+	s.max = max(s.max, value.Float64)
+	s.sum += value.Float64
+	s.count++
+}
+
+// record reports the aggregate at the time ts, if there were any values added.
+func (s *windowStats) record(g windowGauges, ts time.Time, attrs attribute.Set) {
+	if s.count == 0 {
+		return
+	}
+
+	g.min.Record(ts, s.min, attrs)
+	g.max.Record(ts, s.max, attrs)
+	g.avg.Record(ts, s.sum/float64(s.count), attrs)
+}
+
+// runtimeAggregate aggregates the runtime samples of a single attribute set within the collection window.
+type runtimeAggregate struct {
+	attrs attribute.Set
+	// time is the time of the latest sample.
+	time time.Time
+
+	cpu, memory, disk windowStats
+}
+
+// runtimeAggregates aggregates the runtime samples within the collection window by their attributes.
+type runtimeAggregates map[attribute.Distinct]*runtimeAggregate
+
+// add adds the runtime sample, which happened at the time ts, to the aggregate of its attributes.
+func (a runtimeAggregates) add(ts time.Time, attrs attribute.Set, mp fetcher.EngineRuntimePoint) {
+	agg, ok := a[attrs.Equivalent()]
+	if !ok {
+		agg = &runtimeAggregate{attrs: attrs, time: ts}
+		a[attrs.Equivalent()] = agg
+	}
+
+	agg.time = later(agg.time, ts)
+	agg.cpu.add(mp.CPUUsed)
+	agg.memory.add(mp.MemoryUsed)
+	agg.disk.add(mp.DiskUsed)
+}
+
+// recordRuntimeAggregates reports the minimum, maximum and average of the runtime samples within the collection
+// window. The aggregates are stamped with the time of the latest sample.
+func (c *collector) recordRuntimeAggregates(aggregates runtimeAggregates) {
+	for _, agg := range aggregates {
+		agg.cpu.record(c.runtimeMetrics.cpuUtilizationWindow, agg.time, agg.attrs)
+		agg.memory.record(c.runtimeMetrics.memoryUtilizationWindow, agg.time, agg.attrs)
+		agg.disk.record(c.runtimeMetrics.diskUtilizationWindow, agg.time, agg.attrs)
+	}
+}
@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/firebolt-db/otel-exporter/internal/fetcher"
+	"github.com/firebolt-db/otel-exporter/internal/state"
+)
+
+// Backfill collects the metrics of the time range between from and to in consecutive windows of step, and exports
+// the data points of each window before moving to the next one. Only the engines, which are running at the moment
+// Backfill is called, are collected.
+// Backfill will block until the whole range is exported, or provided context is done.
+func (c *collector) Backfill(ctx context.Context, from, to time.Time, step time.Duration) error {
+	if !from.Before(to) {
+		return fmt.Errorf("backfill range start %s must be before its end %s", from, to)
+	}
+	if step <= 0 || step > c.maxCatchUp {
+		return fmt.Errorf("backfill step must be positive and not greater than max catch-up %s", c.maxCatchUp)
+	}
+
+	// only the enabled sources are backfilled, all of them in the same windows.
+	var collectors []collectorFn
+	var finishers []func()
+	for _, src := range c.sources() {
+		if !src.schedule.Enabled {
+			continue
+		}
+
+		collectors = append(collectors, src.collect)
+		if src.finishCycle != nil {
+			finishers = append(finishers, src.finishCycle)
+		}
+	}
+
+	// the list of engines is fetched once, so that all the windows cover the same engines.
+	engines := make(map[string][]fetcher.Engine, len(c.accounts))
+	for _, acctName := range c.accounts {
+		accountEngines, err := c.fetcher.FetchEngines(ctx, acctName)
+		if err != nil {
+			return fmt.Errorf("failed to fetch engines of account %s: %w", acctName, err)
+		}
+
+		engines[acctName] = accountEngines
+	}
+
+	for since := from; since.Before(to); {
+		till := since.Add(step)
+		if till.After(to) {
+			till = to
+		}
+
+		slog.DebugContext(ctx, "start backfilling window", slog.Time("since", since), slog.Time("till", till))
+
+		// engines which failed or timed out in a window resume from their watermark in the next one.
+		cycleCtx, cancel := c.cycleContext(ctx)
+		c.forEachAccount(func(acctName string) {
+			runCollectors(cycleCtx, collectors, acctName, engines[acctName], since, till)
+		})
+		cancel()
+
+		for _, finish := range finishers {
+			finish()
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// export the data points of the window, so that they are pushed in chronological order.
+		if err := c.meterProvider.ForceFlush(ctx); err != nil {
+			return fmt.Errorf("failed to export metrics of window till %s: %w", till, err)
+		}
+
+		slog.InfoContext(ctx, "window backfilled", slog.Time("since", since), slog.Time("till", till))
+
+		since = till
+	}
+
+	c.reportIncompleteBackfill(engines, to)
+
+	return nil
+}
+
+// reportIncompleteBackfill logs the engines, which data was not fully collected up to the end of the backfill range.
+func (c *collector) reportIncompleteBackfill(engines map[string][]fetcher.Engine, to time.Time) {
+	sources := c.sources()
+
+	for accountName, accountEngines := range engines {
+		for _, engine := range accountEngines {
+			for _, source := range sources {
+				watermark, ok := source.progress.watermark(state.Key{Account: accountName, Engine: engine.Name})
+				if ok && watermark.Before(to) {
+					slog.Warn("engine was not backfilled completely",
+						slog.String("accountName", accountName),
+						slog.String("engineName", engine.Name),
+						slog.String("source", source.name),
+						slog.Time("watermark", watermark),
+					)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/firebolt-db/otel-exporter/internal/fetcher"
+)
+
+func Test_Collector_Backfill(t *testing.T) {
+	t.Parallel()
+
+	acctName := "acct"
+	from := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	to := from.Add(25 * time.Minute)
+	engines := []fetcher.Engine{{Name: "engine1", Status: "RUNNING"}}
+
+	f := newFetcherMock()
+	exp := newExporterMock()
+	c, err := NewCollector(f, []string{acctName}, WithExporter(exp))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+	f.fetchEnginesFn = func(ctx context.Context, accountName string) ([]fetcher.Engine, error) {
+		require.Equal(t, acctName, accountName)
+		return engines, nil
+	}
+
+	type window struct{ since, till time.Time }
+	mu := sync.Mutex{}
+	var runtimeWindows, queryHistoryWindows []window
+
+	f.fetchRuntimePointsFn = func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) (<-chan fetcher.EngineRuntimePoint, <-chan error) {
+		mu.Lock()
+		runtimeWindows = append(runtimeWindows, window{since: since, till: till})
+		mu.Unlock()
+
+		ch := make(chan fetcher.EngineRuntimePoint)
+		close(ch)
+		return ch, closedErrCh()
+	}
+	f.fetchQueryHistoryPointsFn = func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) (<-chan fetcher.QueryHistoryPoint, <-chan error) {
+		mu.Lock()
+		queryHistoryWindows = append(queryHistoryWindows, window{since: since, till: till})
+		mu.Unlock()
+
+		ch := make(chan fetcher.QueryHistoryPoint, 1)
+		ch <- fetcher.QueryHistoryPoint{
+			EngineName:    "engine1",
+			QueryID:       sql.NullString{Valid: true, String: till.String()},
+			SubmittedTime: sql.Null[time.Time]{Valid: true, V: till.Add(-time.Minute)},
+			ScannedRows:   sql.NullInt64{Valid: true, Int64: 1},
+		}
+		close(ch)
+		return ch, closedErrCh()
+	}
+
+	// each window is exported on its own, with the data points of the window
+	var exported []metricdata.DataPoint[int64]
+	exp.exportFn = func(ctx context.Context, m *metricdata.ResourceMetrics) error {
+		for _, sm := range m.ScopeMetrics {
+			for _, metrics := range sm.Metrics {
+				if metrics.Name != "firebolt.query.scanned.rows" {
+					continue
+				}
+
+				mu.Lock()
+				exported = append(exported, metrics.Data.(metricdata.Sum[int64]).DataPoints...)
+				mu.Unlock()
+			}
+		}
+		return nil
+	}
+
+	require.NoError(t, c.Backfill(context.Background(), from, to, 10*time.Minute))
+
+	expected := []window{
+		{since: from, till: from.Add(10 * time.Minute)},
+		{since: from.Add(10 * time.Minute), till: from.Add(20 * time.Minute)},
+		{since: from.Add(20 * time.Minute), till: to},
+	}
+	require.Equal(t, expected, runtimeWindows)
+	require.Equal(t, expected, queryHistoryWindows)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, exported, 3)
+	for i, till := range []time.Time{from.Add(10 * time.Minute), from.Add(20 * time.Minute), to} {
+		// the data points are stamped with the end of the window, starting at the end of the first one
+		require.Equal(t, from.Add(10*time.Minute), exported[i].StartTime)
+		require.Equal(t, till, exported[i].Time)
+		require.Equal(t, int64(i+1), exported[i].Value)
+	}
+}
+
+func Test_Collector_Backfill_errors(t *testing.T) {
+	t.Parallel()
+
+	from := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	f := newFetcherMock()
+	c, err := NewCollector(f, []string{"acct"}, WithExporter(newExporterMock()), WithMaxCatchUp(time.Hour))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+	err = c.Backfill(context.Background(), from, from, time.Minute)
+	require.ErrorContains(t, err, "must be before its end")
+
+	err = c.Backfill(context.Background(), from, from.Add(time.Hour), 2*time.Hour)
+	require.ErrorContains(t, err, "backfill step must be positive and not greater than max catch-up 1h0m0s")
+
+	f.fetchEnginesFn = func(ctx context.Context, accountName string) ([]fetcher.Engine, error) {
+		return nil, errors.New("unauthorized")
+	}
+	err = c.Backfill(context.Background(), from, from.Add(time.Hour), time.Minute)
+	require.ErrorContains(t, err, "failed to fetch engines of account acct: unauthorized")
+}
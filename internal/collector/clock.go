@@ -0,0 +1,69 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// clock tells the current time, which the collection windows are based on. Unless it's synced with Firebolt,
+// it's the time of the local clock.
+type clock struct {
+	mu sync.Mutex
+	// skew is the difference between the time of Firebolt and the time of the local clock.
+	skew time.Duration
+	// synced tells whether the clock was synced with Firebolt at least once.
+	synced bool
+}
+
+// now returns the current time.
+func (c *clock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return time.Now().UTC().Add(c.skew)
+}
+
+// until returns the duration of the local clock until provided time.
+func (c *clock) until(t time.Time) time.Duration {
+	return t.Sub(c.now())
+}
+
+// sync sets the skew of the clock from the time of Firebolt, which was read between the local times provided.
+// The time of Firebolt is assumed to be read halfway through the request.
+func (c *clock) sync(serverTime, sentAt, receivedAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.skew = serverTime.Sub(sentAt.Add(receivedAt.Sub(sentAt) / 2))
+	c.synced = true
+}
+
+// observedSkew returns the skew of the clock, and false if it was never synced.
+func (c *clock) observedSkew() (time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.skew, c.synced
+}
+
+// syncClock reads the time of Firebolt and syncs the clock of the collector with it, if the server time is used.
+// In case the time can't be read, the clock keeps the skew it had.
+func (c *collector) syncClock(ctx context.Context) {
+	if !c.serverTime || len(c.accounts) == 0 {
+		return
+	}
+
+	// the time is the same in all the accounts, so it's read from the first one.
+	sentAt := time.Now().UTC()
+	serverTime, err := c.fetcher.FetchServerTime(ctx, c.accounts[0])
+	if err != nil {
+		slog.WarnContext(ctx, "failed to read the server time, the last known clock skew is used",
+			slog.String("accountName", c.accounts[0]), slog.Any("error", err),
+		)
+		return
+	}
+
+	c.clock.sync(serverTime, sentAt, time.Now().UTC())
+}
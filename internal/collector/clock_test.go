@@ -0,0 +1,79 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_clock_sync(t *testing.T) {
+	t.Parallel()
+
+	c := &clock{}
+	_, ok := c.observedSkew()
+	require.False(t, ok)
+
+	// the server time is compared with the local time halfway through the request
+	sentAt := time.Now().UTC()
+	c.sync(sentAt.Add(time.Hour+time.Second), sentAt, sentAt.Add(2*time.Second))
+
+	skew, ok := c.observedSkew()
+	require.True(t, ok)
+	require.Equal(t, time.Hour, skew)
+	require.WithinDuration(t, time.Now().UTC().Add(time.Hour), c.now(), time.Second)
+	require.InDelta(t, time.Hour, c.until(time.Now().UTC().Add(2*time.Hour)), float64(time.Second))
+}
+
+func Test_Collector_syncClock(t *testing.T) {
+	t.Parallel()
+
+	f := newFetcherMock()
+	c, err := NewCollector(f, []string{"acct1", "acct2"}, WithExporter(newExporterMock()), WithServerTime(true))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+	col := c.(*collector)
+
+	var accounts []string
+	f.fetchServerTimeFn = func(ctx context.Context, accountName string) (time.Time, error) {
+		accounts = append(accounts, accountName)
+		return time.Now().UTC().Add(-time.Hour), nil
+	}
+
+	col.syncClock(context.Background())
+	require.Equal(t, []string{"acct1"}, accounts)
+
+	skew, ok := col.clock.observedSkew()
+	require.True(t, ok)
+	require.InDelta(t, -time.Hour, skew, float64(time.Second))
+
+	// the last known skew is kept, if the server time can't be read
+	f.fetchServerTimeFn = func(ctx context.Context, accountName string) (time.Time, error) {
+		return time.Time{}, errors.New("connection refused")
+	}
+
+	col.syncClock(context.Background())
+
+	newSkew, ok := col.clock.observedSkew()
+	require.True(t, ok)
+	require.Equal(t, skew, newSkew)
+}
+
+func Test_Collector_syncClock_disabled(t *testing.T) {
+	t.Parallel()
+
+	// the mock panics if the server time is read
+	c, err := NewCollector(newFetcherMock(), []string{"acct"}, WithExporter(newExporterMock()))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+	col := c.(*collector)
+	col.syncClock(context.Background())
+
+	_, ok := col.clock.observedSkew()
+	require.False(t, ok)
+	require.WithinDuration(t, time.Now().UTC(), col.clock.now(), time.Second)
+}
@@ -2,144 +2,522 @@ package collector
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"log/slog"
+	"strings"
 	"sync"
 	"time"
 
 	"go.opentelemetry.io/otel/attribute"
-	api "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric"
 
 	"github.com/firebolt-db/otel-exporter/internal/fetcher"
+	"github.com/firebolt-db/otel-exporter/internal/state"
 )
 
 // collectorFn is a function which is responsible for collecting metrics in a single account, with list of engines.
-// It is expected that collectorFn will only collect metrics in time interval between `since` and `till`.
+// It is expected that collectorFn will only collect metrics in time interval till `till`, starting from the watermark
+// of each engine. Engines without a watermark start from `since`.
 type collectorFn func(ctx context.Context, wg *sync.WaitGroup, accountName string, engines []fetcher.Engine, since, till time.Time)
 
 // Start runs main metrics collection routine with specified interval.
+// Each source of the metrics is collected on its own schedule, sources without an interval of their own
+// are collected with provided interval.
 // Start will block until provided context is done, or the app is closed.
 func (c *collector) Start(ctx context.Context, interval time.Duration) error {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+	// resume query history collection from where the previous run of the exporter stopped.
+	if err := c.restoreState(ctx); err != nil {
+		return err
+	}
+
+	wg := &sync.WaitGroup{}
+	for _, src := range c.sources() {
+		if !src.schedule.Enabled {
+			slog.InfoContext(ctx, "metrics source is disabled", slog.String("source", src.name))
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.runSource(ctx, src, interval)
+		}()
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+// forEachAccount runs fn for each account on a pool of workers, so that up to accountConcurrency accounts
+// are processed at once. It blocks until fn returns for all the accounts.
+func (c *collector) forEachAccount(fn func(accountName string)) {
+	accounts := make(chan string)
+
+	wg := &sync.WaitGroup{}
+	for range min(max(c.accountConcurrency, 1), len(c.accounts)) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for acctName := range accounts {
+				fn(acctName)
+			}
+		}()
+	}
+
+	for _, acctName := range c.accounts {
+		accounts <- acctName
+	}
+	close(accounts)
+
+	wg.Wait()
+}
+
+// collectAccount collects the source of the metrics for a single account, and reports how long it took.
+func (c *collector) collectAccount(ctx context.Context, src source, accountName string, since, till time.Time) {
+	startTime := time.Now()
+	defer c.reportAccountDuration(ctx, src.name, accountName, startTime)
+
+	// fetch engines first, so that the collectorFn doesn't need to.
+	// In case of failure, watermarks of the account's engines are not advanced.
+	engines, err := c.fetcher.FetchEngines(ctx, accountName)
+	if err != nil {
+		slog.Error("failed to fetch engines",
+			slog.String("accountName", accountName),
+			slog.Any("error", err),
+		)
+		return
+	}
+
+	c.setEngines(accountName, engines)
+	c.forgetStaleSeries(accountName, engines)
+	src.progress.retain(accountName, engines)
+
+	runCollectors(ctx, []collectorFn{src.collect}, accountName, engines, since, till)
+}
+
+// runCollectors runs all the collectorFns for the engines of a single account in parallel, and waits until they finish.
+func runCollectors(ctx context.Context, collectors []collectorFn, accountName string, engines []fetcher.Engine, since, till time.Time) {
+	wg := &sync.WaitGroup{}
+	wg.Add(len(collectors))
+
+	for _, colFn := range collectors {
+		go colFn(ctx, wg, accountName, engines, since, till)
+	}
+
+	wg.Wait()
+}
+
+// reportAccountDuration reports how long collecting the source of the metrics for a single account took.
+func (c *collector) reportAccountDuration(ctx context.Context, sourceName, accountName string, startTime time.Time) {
+	elapsedSeconds := time.Since(startTime).Seconds()
+	c.exporterMetrics.accountDuration.Record(context.WithoutCancel(ctx), elapsedSeconds, metric.WithAttributes(
+		attribute.Key("firebolt.account.name").String(accountName),
+		attribute.Key("firebolt.exporter.source").String(sourceName),
+	))
+
+	slog.DebugContext(ctx, "account collecting duration",
+		slog.String("accountName", accountName), slog.String("source", sourceName),
+		slog.Float64("seconds", elapsedSeconds),
+	)
+}
+
+// cycleContext returns the context of a single collection cycle, which is done once the cycle timeout passes.
+func (c *collector) cycleContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.cycleTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, c.cycleTimeout)
+}
+
+// reportExporterDuration reports main routine duration counter metric of the source.
+func (c *collector) reportExporterDuration(ctx context.Context, sourceName string, startTime time.Time) {
+	elapsedSeconds := float64(time.Since(startTime)) / float64(time.Second)
+	c.exporterMetrics.duration.Add(ctx, elapsedSeconds, metric.WithAttributes(
+		attribute.Key("firebolt.exporter.source").String(sourceName),
+	))
+
+	slog.DebugContext(ctx, "collecting routine duration",
+		slog.String("source", sourceName), slog.Float64("seconds", elapsedSeconds),
+	)
+}
+
+// setEngines remembers the running engines of the account.
+func (c *collector) setEngines(accountName string, engines []fetcher.Engine) {
+	c.enginesMu.Lock()
+	defer c.enginesMu.Unlock()
+
+	if c.engines == nil {
+		c.engines = make(map[string][]fetcher.Engine)
+	}
 
-	collectors := []collectorFn{
-		c.collectRuntimeMetrics,
-		c.collectQueryHistoryMetrics,
+	c.engines[accountName] = engines
+}
+
+// forgetStaleSeries stops reporting the series of the account's engines, which are not running anymore or changed
+// their status, so that their last values are not exported as if they were still current. The status is only compared
+// for the series, which have it as an attribute.
+func (c *collector) forgetStaleSeries(accountName string, engines []fetcher.Engine) {
+	statuses := make(map[string]string, len(engines))
+	for _, engine := range engines {
+		statuses[engine.Name] = engine.Status
 	}
 
-	for {
-		slog.DebugContext(ctx, "start collecting routine")
+	c.producer.Forget(func(attrs attribute.Set) bool {
+		if account, _ := attrs.Value("firebolt.account.name"); account.AsString() != accountName {
+			return false
+		}
+
+		engineName, ok := attrs.Value("firebolt.engine.name")
+		if !ok {
+			return false
+		}
+
+		status, ok := statuses[engineName.AsString()]
+		if !ok {
+			return true
+		}
+
+		engineStatus, ok := attrs.Value("firebolt.engine.status")
+		return ok && status != engineStatus.AsString()
+	})
+}
 
-		since := c.lastCollectedTime
+// engineWindows groups the engines by the start of their collection window. Each engine resumes from its watermark,
+// but not further back than maxCatchUp. Engines seen for the first time start from since.
+func (c *collector) engineWindows(p *progress, accountName string, engines []fetcher.Engine, since, till time.Time) map[time.Time][]fetcher.Engine {
+	earliest := till.Add(-c.maxCatchUp)
 
-		collectTime := time.Now().UTC()
-		c.lastCollectedTime = collectTime
+	windows := make(map[time.Time][]fetcher.Engine)
+	for _, engine := range engines {
+		start := p.start(state.Key{Account: accountName, Engine: engine.Name}, since, earliest)
+		windows[start] = append(windows[start], engine)
+	}
 
-		func() {
-			defer c.reportExporterDuration(ctx, collectTime)
+	return windows
+}
 
-			// run all collectorFns for each account synchronously
-			for _, acctName := range c.accounts {
-				// fetch engines first, so that the collectorFn doesn't need to
-				engines, err := c.fetcher.FetchEngines(ctx, acctName)
-				if err != nil {
-					slog.Error("failed to fetch engines",
-						slog.String("accountName", acctName),
-						slog.Any("error", err),
-					)
-					continue
-				}
+// fetchWindows runs fetchFn for each window in parallel. The fetchFn is expected to consume all the data points of
+// the window, and return the channel of errors reported by the fetcher. It returns all the errors reported.
+func fetchWindows(windows map[time.Time][]fetcher.Engine, fetchFn func(since time.Time, engines []fetcher.Engine) <-chan error) []error {
+	mu := sync.Mutex{}
+	var errs []error
 
-				wg := &sync.WaitGroup{}
-				wg.Add(len(collectors))
+	wg := &sync.WaitGroup{}
+	wg.Add(len(windows))
 
-				// run all collectors for the account in parallel
-				for _, colFn := range collectors {
-					go colFn(ctx, wg, acctName, engines, since, collectTime)
-				}
+	for since, engines := range windows {
+		go func() {
+			defer wg.Done()
 
-				wg.Wait()
+			for err := range fetchFn(since, engines) {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
 			}
 		}()
+	}
 
-		slog.DebugContext(ctx, "finished collecting routine")
+	wg.Wait()
 
-		select {
-		case <-ctx.Done():
-			return nil
-		case <-ticker.C:
+	return errs
+}
+
+// advanceWatermarks moves the watermarks of the engines to the end of the window, except the engines which data
+// was not fetched completely. Those engines will collect the same window again on the next cycle.
+func advanceWatermarks(p *progress, accountName string, engines []fetcher.Engine, errs []error, till time.Time, lookback time.Duration) {
+	failed := make(map[string]struct{}, len(errs))
+	for _, err := range errs {
+		var engineErr *fetcher.EngineError
+		if !errors.As(err, &engineErr) {
+			// the failure can't be attributed to an engine, so none of them is considered delivered.
+			return
+		}
+
+		failed[engineErr.EngineName] = struct{}{}
+	}
+
+	for _, engine := range engines {
+		if _, ok := failed[engine.Name]; ok {
 			continue
 		}
+
+		p.advance(state.Key{Account: accountName, Engine: engine.Name}, till, lookback)
 	}
 }
 
-// reportExporterDuration reports main routine duration counter metric.
-func (c *collector) reportExporterDuration(ctx context.Context, startTime time.Time) {
-	elapsedSeconds := float64(time.Since(startTime)) / float64(time.Second)
-	c.exporterMetrics.duration.Add(ctx, elapsedSeconds)
+// reportEngineTimeouts counts the engines, which data points of the source were not fetched before the engine
+// or the cycle timeout passed.
+func (c *collector) reportEngineTimeouts(ctx context.Context, accountName, source string, errs []error) {
+	for _, err := range errs {
+		var engineErr *fetcher.EngineError
+		if !errors.As(err, &engineErr) || !errors.Is(err, context.DeadlineExceeded) {
+			continue
+		}
+
+		slog.WarnContext(ctx, "engine timed out",
+			slog.String("accountName", accountName),
+			slog.String("engineName", engineErr.EngineName),
+			slog.String("source", source),
+		)
+
+		c.exporterMetrics.engineTimeouts.Add(context.WithoutCancel(ctx), 1, metric.WithAttributes(
+			attribute.Key("firebolt.account.name").String(accountName),
+			attribute.Key("firebolt.engine.name").String(engineErr.EngineName),
+			attribute.Key("firebolt.exporter.source").String(source),
+		))
+	}
+}
 
-	slog.DebugContext(ctx, "collecting routine duration", slog.Float64("seconds", elapsedSeconds))
+// pointTime returns the timestamp of a data point, which is the time reported by Firebolt, if any.
+// Otherwise, it's the end of the window the data point was collected in.
+func pointTime(t sql.Null[time.Time], till time.Time) time.Time {
+	if !t.Valid {
+		return till
+	}
+	return t.V
 }
 
 // collectRuntimeMetrics collects and reports engine runtime metrics, such as cpu utilization, memory utilization etc.
 func (c *collector) collectRuntimeMetrics(ctx context.Context, wg *sync.WaitGroup, accountName string, engines []fetcher.Engine, since, till time.Time) {
 	slog.DebugContext(ctx, "start collecting runtime metrics", slog.String("accountName", accountName))
 
-	pointsCh := c.fetcher.FetchRuntimePoints(ctx, accountName, engines, since, till)
+	windows := c.engineWindows(c.runtimeProgress, accountName, engines, since, till)
 
-	for mp := range pointsCh {
-		attrs := []attribute.KeyValue{
-			attribute.Key("firebolt.account.name").String(accountName),
-			attribute.Key("firebolt.engine.name").String(mp.EngineName),
-			attribute.Key("firebolt.engine.status").String(mp.EngineStatus),
+	errs := fetchWindows(windows, func(windowSince time.Time, windowEngines []fetcher.Engine) <-chan error {
+		pointsCh, errCh := c.fetcher.FetchRuntimePoints(ctx, accountName, windowEngines, windowSince, till)
+
+		aggregates := make(runtimeAggregates)
+		for mp := range pointsCh {
+			if mp.EventTime.Valid {
+				c.runtimeProgress.see(state.Key{Account: accountName, Engine: mp.EngineName}, mp.EventTime.V)
+			}
+
+			ts := pointTime(mp.EventTime, till)
+			attrs := runtimeAttributes(accountName, mp)
+
+			c.recordRuntimePoint(ts, attrs, mp)
+			if c.runtimeWindowAggregates {
+				aggregates.add(ts, attrs, mp)
+			}
 		}
 
-		attrsSet := attribute.NewSet(attrs...)
+		c.recordRuntimeAggregates(aggregates)
 
-		c.runtimeMetrics.cpuUtilization.Record(ctx, mp.CPUUsed.Float64, api.WithAttributeSet(attrsSet))
-		c.runtimeMetrics.memoryUtilization.Record(ctx, mp.MemoryUsed.Float64, api.WithAttributeSet(attrsSet))
-		c.runtimeMetrics.diskUtilization.Record(ctx, mp.DiskUsed.Float64, api.WithAttributeSet(attrsSet))
-		c.runtimeMetrics.cacheUtilization.Record(ctx, mp.CacheHitRatio.Float64, api.WithAttributeSet(attrsSet))
-		c.runtimeMetrics.diskSpilled.Record(ctx, mp.SpilledBytes.Int64, api.WithAttributeSet(attrsSet))
-		c.runtimeMetrics.runningQueries.Record(ctx, mp.RunningQueries.Int64, api.WithAttributeSet(attrsSet))
-		c.runtimeMetrics.suspendedQueries.Record(ctx, mp.SuspendedQueries.Int64, api.WithAttributeSet(attrsSet))
-	}
+		return errCh
+	})
+
+	c.reportEngineTimeouts(ctx, accountName, "runtime", errs)
+	advanceWatermarks(c.runtimeProgress, accountName, engines, errs, till, 0)
 
 	wg.Done()
 
 	slog.DebugContext(ctx, "collecting runtime metrics routine finished", slog.String("accountName", accountName))
 }
 
+// runtimeAttributes returns the attributes of engine runtime metrics of a single point.
+func runtimeAttributes(accountName string, mp fetcher.EngineRuntimePoint) attribute.Set {
+	return attribute.NewSet(
+		attribute.Key("firebolt.account.name").String(accountName),
+		attribute.Key("firebolt.engine.name").String(mp.EngineName),
+		attribute.Key("firebolt.engine.status").String(mp.EngineStatus),
+		attribute.Key("firebolt.engine.cluster").String(mp.EngineCluster.String),
+	)
+}
+
+// recordRuntimePoint reports engine runtime metrics of a single point at the time ts.
+func (c *collector) recordRuntimePoint(ts time.Time, attrsSet attribute.Set, mp fetcher.EngineRuntimePoint) {
+	c.runtimeMetrics.cpuUtilization.Record(ts, mp.CPUUsed.Float64, attrsSet)
+	c.runtimeMetrics.memoryUtilization.Record(ts, mp.MemoryUsed.Float64, attrsSet)
+	c.runtimeMetrics.diskUtilization.Record(ts, mp.DiskUsed.Float64, attrsSet)
+	c.runtimeMetrics.cacheUtilization.Record(ts, mp.CacheHitRatio.Float64, attrsSet)
+	c.runtimeMetrics.diskSpilled.Record(ts, mp.SpilledBytes.Int64, attrsSet)
+	c.runtimeMetrics.runningQueries.Record(ts, mp.RunningQueries.Int64, attrsSet)
+	c.runtimeMetrics.suspendedQueries.Record(ts, mp.SuspendedQueries.Int64, attrsSet)
+}
+
 // collectQueryHistoryMetrics collects and reports query history metrics, such as rows and bytes scanned, etc.
 func (c *collector) collectQueryHistoryMetrics(ctx context.Context, wg *sync.WaitGroup, accountName string, engines []fetcher.Engine, since, till time.Time) {
 	slog.DebugContext(ctx, "start collecting query history metrics", slog.String("accountName", accountName))
 
-	pointsCh := c.fetcher.FetchQueryHistoryPoints(ctx, accountName, engines, since, till)
+	windows := c.engineWindows(c.queryHistoryProgress, accountName, engines, since, till)
+	fingerprints := newFingerprintTracker()
 
-	for mp := range pointsCh {
-		attrs := []attribute.KeyValue{
-			attribute.Key("firebolt.account.name").String(accountName),
-			attribute.Key("firebolt.engine.name").String(mp.EngineName),
-			attribute.Key("firebolt.engine.status").String(mp.EngineStatus),
-			attribute.Key("firebolt.user.name").String(mp.UserName.String),
-			attribute.Key("firebolt.query.status").String(mp.Status.String),
+	errs := fetchWindows(windows, func(windowSince time.Time, windowEngines []fetcher.Engine) <-chan error {
+		// the window is extended by the lookback, so that queries which finished after the window they were
+		// submitted in are read too. Queries read more than once are reported only once.
+		pointsCh, errCh := c.fetcher.FetchQueryHistoryPoints(ctx, accountName, windowEngines,
+			windowSince.Add(-c.queryHistoryLookback), till,
+		)
+
+		for mp := range pointsCh {
+			if mp.SubmittedTime.Valid {
+				c.queryHistoryProgress.see(state.Key{Account: accountName, Engine: mp.EngineName}, mp.SubmittedTime.V)
+			}
+
+			// the counters and histograms are reported at the end of the window, so that the values of late queries,
+			// which were submitted before the time already reported, are reported at a new time.
+			if !c.recordQueryHistoryPoint(accountName, till, mp) {
+				continue
+			}
+
+			if c.queryFingerprintsTopK > 0 {
+				fingerprints.add(mp.EngineName, queryFingerprint(mp.QueryText.String),
+					float64(mp.DurationMicroSeconds.Int64)/1000000, mp.ScannedBytes.Int64,
+				)
+			}
+
+			c.emitQueryLog(ctx, accountName, mp)
+			c.emitQuerySpan(ctx, accountName, mp)
+			c.reportSlowQuery(ctx, accountName, till, mp)
 		}
 
-		attrsSet := attribute.NewSet(attrs...)
+		return errCh
+	})
 
-		c.queryHistoryMetrics.queryDuration.Record(ctx, float64(mp.DurationMicroSeconds.Int64)/1000000, api.WithAttributeSet(attrsSet))
-		c.queryHistoryMetrics.scannedRows.Add(ctx, mp.ScannedRows.Int64, api.WithAttributeSet(attrsSet))
-		c.queryHistoryMetrics.scannedBytes.Add(ctx, mp.ScannedBytes.Int64, api.WithAttributeSet(attrsSet))
-		c.queryHistoryMetrics.insertedRows.Add(ctx, mp.InsertedRows.Int64, api.WithAttributeSet(attrsSet))
-		c.queryHistoryMetrics.insertedBytes.Add(ctx, mp.InsertedBytes.Int64, api.WithAttributeSet(attrsSet))
-		c.queryHistoryMetrics.returnedRows.Add(ctx, mp.ReturnedRows.Int64, api.WithAttributeSet(attrsSet))
-		c.queryHistoryMetrics.returnedBytes.Add(ctx, mp.ReturnedBytes.Int64, api.WithAttributeSet(attrsSet))
-		c.queryHistoryMetrics.spilledBytes.Add(ctx, mp.SpilledBytes.Int64, api.WithAttributeSet(attrsSet))
-		c.queryHistoryMetrics.queueTime.Add(ctx, float64(mp.TimeInQueueMicroSeconds.Int64)/1000000, api.WithAttributeSet(attrsSet))
-		c.queryHistoryMetrics.queryGatewayDuration.Record(ctx, float64(mp.GatewayDurationMicroSeconds.Int64)/1000000, api.WithAttributeSet(attrsSet))
-	}
+	c.recordQueryFingerprints(accountName, engines, till, fingerprints)
+	c.reportEngineTimeouts(ctx, accountName, "query_history", errs)
+	advanceWatermarks(c.queryHistoryProgress, accountName, engines, errs, till, c.queryHistoryLookback)
 
 	wg.Done()
 
 	slog.DebugContext(ctx, "collecting query history metrics routine finished", slog.String("accountName", accountName))
 }
+
+// recordQueryHistoryPoint reports query history metrics of a single query at the time ts, unless it was already reported.
+// Queries of the exporter itself are reported separately, unless they are configured to be included.
+// It returns true if the query was reported in the query history metrics.
+func (c *collector) recordQueryHistoryPoint(accountName string, ts time.Time, mp fetcher.QueryHistoryPoint) bool {
+	key := state.Key{Account: accountName, Engine: mp.EngineName}
+	if mp.QueryID.Valid && !c.queryHistoryProgress.report(key, mp.QueryID.String, mp.SubmittedTime.V) {
+		return false
+	}
+
+	if mp.Exporter {
+		c.recordExporterQuery(accountName, ts, mp)
+
+		if !c.includeExporterQueries {
+			return false
+		}
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.Key("firebolt.account.name").String(accountName),
+		attribute.Key("firebolt.engine.name").String(mp.EngineName),
+		attribute.Key("firebolt.engine.status").String(mp.EngineStatus),
+		attribute.Key("firebolt.user.name").String(mp.UserName.String),
+		attribute.Key("firebolt.query.status").String(mp.Status.String),
+		attribute.Key("firebolt.query.type").String(statementType(mp.QueryText.String)),
+	}
+
+	if c.queryLabeler.Enabled {
+		attrs = append(attrs, attribute.Key("firebolt.query.label").String(c.queryLabeler.label(mp.QueryLabel.String)))
+	}
+
+	attrsSet := attribute.NewSet(attrs...)
+
+	c.queryHistoryMetrics.queryCount.Add(ts, 1, attrsSet)
+	if errorClass, ok := queryErrorClass(mp); ok {
+		c.queryHistoryMetrics.queryErrors.Add(ts, 1, attribute.NewSet(append(attrs,
+			attribute.Key("firebolt.query.error.class").String(errorClass),
+			attribute.Key("firebolt.query.error.fingerprint").String(c.errorClassifier.Classify(mp.ErrorMessage.String)),
+		)...))
+	}
+
+	c.queryHistoryMetrics.queryDuration.Record(ts, float64(mp.DurationMicroSeconds.Int64)/1000000, attrsSet)
+	c.queryHistoryMetrics.scannedRows.Add(ts, mp.ScannedRows.Int64, attrsSet)
+	c.queryHistoryMetrics.scannedBytes.Add(ts, mp.ScannedBytes.Int64, attrsSet)
+	c.queryHistoryMetrics.insertedRows.Add(ts, mp.InsertedRows.Int64, attrsSet)
+	c.queryHistoryMetrics.insertedBytes.Add(ts, mp.InsertedBytes.Int64, attrsSet)
+	c.queryHistoryMetrics.returnedRows.Add(ts, mp.ReturnedRows.Int64, attrsSet)
+	c.queryHistoryMetrics.returnedBytes.Add(ts, mp.ReturnedBytes.Int64, attrsSet)
+	c.queryHistoryMetrics.spilledBytes.Add(ts, mp.SpilledBytes.Int64, attrsSet)
+	c.queryHistoryMetrics.queueTime.Add(ts, float64(mp.TimeInQueueMicroSeconds.Int64)/1000000, attrsSet)
+	c.queryHistoryMetrics.queryGatewayDuration.Record(ts, float64(mp.GatewayDurationMicroSeconds.Int64)/1000000, attrsSet)
+
+	return true
+}
+
+// recordQueryFingerprints reports the load of the heaviest query fingerprints of each engine, which were collected
+// within the cycle, at the end of the collected window. The load of the other fingerprints is reported as other,
+// so that the number of series of each engine is bounded. The series of the fingerprints, which are not among the
+// heaviest ones of the cycle anymore, are not exported after their pending values.
+func (c *collector) recordQueryFingerprints(accountName string, engines []fetcher.Engine, till time.Time, fingerprints *fingerprintTracker) {
+	if c.queryFingerprintsTopK <= 0 {
+		return
+	}
+
+	top := fingerprints.top(c.queryFingerprintsTopK)
+	for engineName, engineTop := range top {
+		for fingerprint, stats := range engineTop {
+			attrsSet := attribute.NewSet(
+				attribute.Key("firebolt.account.name").String(accountName),
+				attribute.Key("firebolt.engine.name").String(engineName),
+				attribute.Key("firebolt.query.fingerprint").String(fingerprint),
+			)
+
+			c.queryHistoryMetrics.fingerprintQueries.Add(till, stats.count, attrsSet)
+			c.queryHistoryMetrics.fingerprintDuration.Add(till, stats.duration, attrsSet)
+			c.queryHistoryMetrics.fingerprintScannedBytes.Add(till, stats.scannedBytes, attrsSet)
+		}
+	}
+
+	collected := make(map[string]struct{}, len(engines))
+	for _, engine := range engines {
+		collected[engine.Name] = struct{}{}
+	}
+
+	c.producer.Forget(func(attrs attribute.Set) bool {
+		if account, _ := attrs.Value("firebolt.account.name"); account.AsString() != accountName {
+			return false
+		}
+
+		fingerprint, ok := attrs.Value("firebolt.query.fingerprint")
+		if !ok {
+			return false
+		}
+
+		engineName, _ := attrs.Value("firebolt.engine.name")
+		if _, ok := collected[engineName.AsString()]; !ok {
+			return false
+		}
+
+		_, ok = top[engineName.AsString()][fingerprint.AsString()]
+		return !ok
+	})
+}
+
+// queryErrorClass returns the class of the error, which the query failed with, and false if the query didn't fail.
+// The class is told by the status of the query, so that it has a few distinct values. Canceled queries are not
+// considered failed.
+func queryErrorClass(mp fetcher.QueryHistoryPoint) (string, bool) {
+	switch status := mp.Status.String; {
+	case status == "ENDED_SUCCESSFULLY", status == "CANCELED_EXECUTION":
+		return "", false
+	case strings.HasSuffix(status, "_ERROR"):
+		// PARSE_ERROR and EXECUTION_ERROR are reported as parse and execution.
+		return strings.ToLower(strings.TrimSuffix(status, "_ERROR")), true
+	case mp.ErrorMessage.String != "":
+		// the query failed, though its status doesn't tell how.
+		return "unknown", true
+	default:
+		return "", false
+	}
+}
+
+// recordExporterQuery reports the load of a single query, which was executed by the exporter itself.
+func (c *collector) recordExporterQuery(accountName string, ts time.Time, mp fetcher.QueryHistoryPoint) {
+	attrsSet := attribute.NewSet(
+		attribute.Key("firebolt.account.name").String(accountName),
+		attribute.Key("firebolt.engine.name").String(mp.EngineName),
+		attribute.Key("firebolt.engine.status").String(mp.EngineStatus),
+	)
+
+	c.queryHistoryMetrics.exporterQueries.Add(ts, 1, attrsSet)
+	c.queryHistoryMetrics.exporterQueryDuration.Add(ts, float64(mp.DurationMicroSeconds.Int64)/1000000, attrsSet)
+	c.queryHistoryMetrics.exporterScannedBytes.Add(ts, mp.ScannedBytes.Int64, attrsSet)
+}
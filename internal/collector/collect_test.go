@@ -3,6 +3,9 @@ package collector
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -13,6 +16,7 @@ import (
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 
 	"github.com/firebolt-db/otel-exporter/internal/fetcher"
+	"github.com/firebolt-db/otel-exporter/internal/state"
 )
 
 func Test_Collector_Start(t *testing.T) {
@@ -38,16 +42,16 @@ func Test_Collector_Start(t *testing.T) {
 		return eng, nil
 	}
 	rCh := make(chan fetcher.EngineRuntimePoint)
-	f.fetchRuntimePointsFn = func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) <-chan fetcher.EngineRuntimePoint {
+	f.fetchRuntimePointsFn = func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) (<-chan fetcher.EngineRuntimePoint, <-chan error) {
 		require.Equal(t, acctName, account)
 		require.Equal(t, eng, engines)
-		return rCh
+		return rCh, closedErrCh()
 	}
 	qhCh := make(chan fetcher.QueryHistoryPoint)
-	f.fetchQueryHistoryPointsFn = func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) <-chan fetcher.QueryHistoryPoint {
+	f.fetchQueryHistoryPointsFn = func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) (<-chan fetcher.QueryHistoryPoint, <-chan error) {
 		require.Equal(t, acctName, account)
 		require.Equal(t, eng, engines)
-		return qhCh
+		return qhCh, closedErrCh()
 	}
 	exportCalled := atomic.Bool{}
 	exportCalled.Store(false)
@@ -97,3 +101,754 @@ func Test_Collector_Start(t *testing.T) {
 		return exportCalled.Load()
 	}, 1000*time.Millisecond, 10*time.Millisecond)
 }
+
+func Test_Collector_forEachAccount(t *testing.T) {
+	t.Parallel()
+
+	accounts := []string{"acct1", "acct2", "acct3", "acct4", "acct5"}
+	c, err := NewCollector(newFetcherMock(), accounts, WithExporter(newExporterMock()), WithAccountConcurrency(2))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+	var mu sync.Mutex
+	var running, maxRunning int
+	var visited []string
+
+	c.(*collector).forEachAccount(func(accountName string) {
+		mu.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		visited = append(visited, accountName)
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+
+	require.ElementsMatch(t, accounts, visited)
+	require.Equal(t, 2, maxRunning)
+}
+
+func Test_Collector_collectAccount_duration(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	counts := make(map[string]uint64)
+
+	exp := newExporterMock()
+	exp.exportFn = func(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if m.Name != "firebolt.exporter.account.duration" {
+					continue
+				}
+				for _, dp := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+					accountName, _ := dp.Attributes.Value("firebolt.account.name")
+					counts[accountName.AsString()] = dp.Count
+				}
+			}
+		}
+		return nil
+	}
+
+	f := newFetcherMock()
+	f.fetchEnginesFn = func(ctx context.Context, accountName string) ([]fetcher.Engine, error) {
+		return nil, errors.New("unauthorized")
+	}
+
+	c, err := NewCollector(f, []string{"acct1", "acct2"}, WithExporter(exp))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+	col := c.(*collector)
+	now := time.Now().UTC()
+
+	// the duration is reported even if the account could not be collected
+	src := col.sources()[0]
+	col.collectAccount(context.Background(), src, "acct1", now.Add(-30*time.Second), now)
+	col.collectAccount(context.Background(), src, "acct1", now, now.Add(30*time.Second))
+	col.collectAccount(context.Background(), src, "acct2", now, now.Add(30*time.Second))
+
+	require.NoError(t, col.meterProvider.ForceFlush(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, map[string]uint64{"acct1": 2, "acct2": 1}, counts)
+}
+
+func Test_Collector_collectQueryHistoryMetrics_resume(t *testing.T) {
+	t.Parallel()
+
+	acctName := "acct"
+	till := time.Now().UTC()
+	since := till.Add(-30 * time.Second)
+
+	store := state.NewMemoryStore()
+	require.NoError(t, store.Save(context.Background(), &state.State{
+		Engines: map[state.Key]state.EngineState{
+			// resumed from the watermark
+			{Account: acctName, Engine: "engine1"}: {
+				Watermark:       till.Add(-2 * time.Minute),
+				ReportedQueries: map[string]time.Time{"q1": till.Add(-3 * time.Minute)},
+			},
+			// resumed from the max catch-up
+			{Account: acctName, Engine: "engine2"}: {
+				Watermark:       till.Add(-3 * time.Hour),
+				ReportedQueries: map[string]time.Time{},
+			},
+		},
+	}))
+
+	f := newFetcherMock()
+	c, err := NewCollector(f, []string{acctName},
+		WithExporter(newExporterMock()),
+		WithQueryHistoryLookback(5*time.Minute),
+		WithStateStore(store),
+		WithMaxCatchUp(time.Hour),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+	col := c.(*collector)
+	require.NoError(t, col.restoreState(context.Background()))
+
+	mu := sync.Mutex{}
+	windows := make(map[string]time.Time)
+	f.fetchQueryHistoryPointsFn = func(ctx context.Context, account string, engines []fetcher.Engine, fetchSince, fetchTill time.Time) (<-chan fetcher.QueryHistoryPoint, <-chan error) {
+		require.Equal(t, till, fetchTill)
+
+		ch := make(chan fetcher.QueryHistoryPoint, len(engines))
+		mu.Lock()
+		for _, engine := range engines {
+			windows[engine.Name] = fetchSince
+
+			ch <- fetcher.QueryHistoryPoint{
+				EngineName:    engine.Name,
+				QueryID:       sql.NullString{Valid: true, String: "q1"},
+				SubmittedTime: sql.Null[time.Time]{Valid: true, V: till.Add(-3 * time.Minute)},
+			}
+		}
+		mu.Unlock()
+		close(ch)
+
+		return ch, closedErrCh()
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	col.collectQueryHistoryMetrics(context.Background(), wg, acctName, []fetcher.Engine{
+		{Name: "engine1", Status: "RUNNING"},
+		{Name: "engine2", Status: "RUNNING"},
+		{Name: "engine3", Status: "RUNNING"},
+	}, since, till)
+	wg.Wait()
+
+	require.Equal(t, map[string]time.Time{
+		"engine1": till.Add(-7 * time.Minute),
+		"engine2": till.Add(-65 * time.Minute),
+		"engine3": since.Add(-5 * time.Minute),
+	}, windows)
+
+	// watermarks are advanced, reported queries within the next lookback window are kept
+	s := col.queryHistoryProgress.snapshot()
+	for _, engine := range []string{"engine1", "engine2", "engine3"} {
+		require.Equal(t, till, s.Engines[state.Key{Account: acctName, Engine: engine}].Watermark)
+		require.Contains(t, s.Engines[state.Key{Account: acctName, Engine: engine}].ReportedQueries, "q1")
+	}
+}
+
+func Test_Collector_collectQueryHistoryMetrics_latePoints(t *testing.T) {
+	t.Parallel()
+
+	acctName := "acct"
+	till1 := time.Date(2024, 1, 1, 10, 10, 0, 0, time.UTC)
+	till2 := till1.Add(30 * time.Second)
+	engines := []fetcher.Engine{{Name: "engine1", Status: "RUNNING"}}
+
+	f := newFetcherMock()
+	c, err := NewCollector(f, []string{acctName}, WithExporter(newExporterMock()), WithQueryHistoryLookback(10*time.Minute))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+	col := c.(*collector)
+
+	// the second window reads a query, which was submitted before the first one ended, within the lookback
+	queries := map[time.Time]fetcher.QueryHistoryPoint{
+		till1: {
+			EngineName:    "engine1",
+			QueryID:       sql.NullString{Valid: true, String: "q1"},
+			SubmittedTime: sql.Null[time.Time]{Valid: true, V: till1},
+			ScannedRows:   sql.NullInt64{Valid: true, Int64: 1},
+		},
+		till2: {
+			EngineName:    "engine1",
+			QueryID:       sql.NullString{Valid: true, String: "q2"},
+			SubmittedTime: sql.Null[time.Time]{Valid: true, V: till1.Add(-5 * time.Minute)},
+			ScannedRows:   sql.NullInt64{Valid: true, Int64: 1},
+		},
+	}
+	f.fetchQueryHistoryPointsFn = func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) (<-chan fetcher.QueryHistoryPoint, <-chan error) {
+		ch := make(chan fetcher.QueryHistoryPoint, 1)
+		ch <- queries[till]
+		close(ch)
+
+		return ch, closedErrCh()
+	}
+
+	var points []metricdata.DataPoint[int64]
+	for _, till := range []time.Time{till1, till2} {
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		col.collectQueryHistoryMetrics(context.Background(), wg, acctName, engines, till.Add(-30*time.Second), till)
+		wg.Wait()
+
+		sm, err := col.producer.Produce(context.Background())
+		require.NoError(t, err)
+
+		for _, m := range sm[0].Metrics {
+			if m.Name == "firebolt.query.scanned.rows" {
+				points = append(points, m.Data.(metricdata.Sum[int64]).DataPoints...)
+			}
+		}
+	}
+
+	// the series keeps its start, and the late query is reported at a new time
+	require.Len(t, points, 2)
+	require.Equal(t, till1, points[0].StartTime)
+	require.Equal(t, till1, points[0].Time)
+	require.Equal(t, int64(1), points[0].Value)
+	require.Equal(t, till1, points[1].StartTime)
+	require.Equal(t, till2, points[1].Time)
+	require.Equal(t, int64(2), points[1].Value)
+}
+
+func Test_Collector_collectQueryHistoryMetrics_failure(t *testing.T) {
+	t.Parallel()
+
+	acctName := "acct"
+	till := time.Now().UTC()
+	since := till.Add(-30 * time.Second)
+
+	f := newFetcherMock()
+	c, err := NewCollector(f, []string{acctName}, WithExporter(newExporterMock()))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+	col := c.(*collector)
+	engines := []fetcher.Engine{
+		{Name: "engine1", Status: "RUNNING"},
+		{Name: "engine2", Status: "RUNNING"},
+	}
+
+	f.fetchQueryHistoryPointsFn = func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) (<-chan fetcher.QueryHistoryPoint, <-chan error) {
+		ch := make(chan fetcher.QueryHistoryPoint)
+		close(ch)
+
+		errCh := make(chan error, 1)
+		errCh <- &fetcher.EngineError{EngineName: "engine2", Err: errors.New("connection lost")}
+		close(errCh)
+
+		return ch, errCh
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	col.collectQueryHistoryMetrics(context.Background(), wg, acctName, engines, since, till)
+	wg.Wait()
+
+	// watermark of the failed engine stays at the start of the window, so that the window is collected again
+	wm, ok := col.queryHistoryProgress.watermark(state.Key{Account: acctName, Engine: "engine1"})
+	require.True(t, ok)
+	require.Equal(t, till, wm)
+
+	wm, ok = col.queryHistoryProgress.watermark(state.Key{Account: acctName, Engine: "engine2"})
+	require.True(t, ok)
+	require.Equal(t, since, wm)
+}
+
+func Test_Collector_collectRuntimeMetrics_engineTimeout(t *testing.T) {
+	t.Parallel()
+
+	acctName := "acct"
+	till := time.Now().UTC()
+	since := till.Add(-30 * time.Second)
+
+	var mu sync.Mutex
+	timeouts := make(map[string]int64)
+
+	exp := newExporterMock()
+	exp.exportFn = func(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if m.Name != "firebolt.exporter.engine.timeouts" {
+					continue
+				}
+				for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+					engineName, _ := dp.Attributes.Value("firebolt.engine.name")
+					timeouts[engineName.AsString()] = dp.Value
+				}
+			}
+		}
+		return nil
+	}
+
+	f := newFetcherMock()
+	c, err := NewCollector(f, []string{acctName}, WithExporter(exp))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+	col := c.(*collector)
+	engines := []fetcher.Engine{
+		{Name: "engine1", Status: "RUNNING"},
+		{Name: "engine2", Status: "RUNNING"},
+		{Name: "engine3", Status: "RUNNING"},
+	}
+
+	f.fetchRuntimePointsFn = func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) (<-chan fetcher.EngineRuntimePoint, <-chan error) {
+		ch := make(chan fetcher.EngineRuntimePoint)
+		close(ch)
+
+		errCh := make(chan error, 2)
+		errCh <- &fetcher.EngineError{EngineName: "engine2", Err: context.DeadlineExceeded}
+		errCh <- &fetcher.EngineError{EngineName: "engine3", Err: errors.New("connection lost")}
+		close(errCh)
+
+		return ch, errCh
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	col.collectRuntimeMetrics(context.Background(), wg, acctName, engines, since, till)
+	wg.Wait()
+
+	// only the engines which failed or timed out are collected again
+	for engineName, expected := range map[string]time.Time{"engine1": till, "engine2": since, "engine3": since} {
+		wm, ok := col.runtimeProgress.watermark(state.Key{Account: acctName, Engine: engineName})
+		require.True(t, ok)
+		require.Equal(t, expected, wm, engineName)
+	}
+
+	require.NoError(t, col.meterProvider.ForceFlush(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, map[string]int64{"engine2": 1}, timeouts)
+}
+
+// closedErrCh returns a closed channel of errors, which means that all the data points were fetched.
+func closedErrCh() <-chan error {
+	ch := make(chan error)
+	close(ch)
+	return ch
+}
+
+func Test_Collector_collectRuntimeMetrics_timestamps(t *testing.T) {
+	t.Parallel()
+
+	acctName := "acct"
+	till := time.Now().UTC()
+	since := till.Add(-30 * time.Second)
+	eventTime := till.Add(-10 * time.Second)
+
+	f := newFetcherMock()
+	c, err := NewCollector(f, []string{acctName}, WithExporter(newExporterMock()))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+	col := c.(*collector)
+	f.fetchRuntimePointsFn = func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) (<-chan fetcher.EngineRuntimePoint, <-chan error) {
+		ch := make(chan fetcher.EngineRuntimePoint, 2)
+		ch <- fetcher.EngineRuntimePoint{
+			EngineName: "engine1",
+			EventTime:  sql.Null[time.Time]{Valid: true, V: eventTime},
+			CPUUsed:    sql.NullFloat64{Valid: true, Float64: 10},
+		}
+		// the point without event_time is stamped with the end of the window
+		ch <- fetcher.EngineRuntimePoint{
+			EngineName: "engine2",
+			CPUUsed:    sql.NullFloat64{Valid: true, Float64: 20},
+		}
+		close(ch)
+
+		return ch, closedErrCh()
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	col.collectRuntimeMetrics(context.Background(), wg, acctName, []fetcher.Engine{
+		{Name: "engine1", Status: "RUNNING"},
+		{Name: "engine2", Status: "RUNNING"},
+	}, since, till)
+	wg.Wait()
+
+	sm, err := col.producer.Produce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, sm, 1)
+
+	times := make(map[string]time.Time)
+	for _, m := range sm[0].Metrics {
+		if m.Name != "firebolt.engine.cpu.utilization" {
+			continue
+		}
+
+		for _, point := range m.Data.(metricdata.Gauge[float64]).DataPoints {
+			engineName, _ := point.Attributes.Value("firebolt.engine.name")
+			times[engineName.AsString()] = point.Time
+		}
+	}
+
+	require.Equal(t, map[string]time.Time{"engine1": eventTime, "engine2": till}, times)
+
+	// only the points with event_time tell how fresh the data of the engine is
+	newest, ok := col.runtimeProgress.newest(state.Key{Account: acctName, Engine: "engine1"})
+	require.True(t, ok)
+	require.Equal(t, eventTime, newest)
+
+	_, ok = col.runtimeProgress.newest(state.Key{Account: acctName, Engine: "engine2"})
+	require.False(t, ok)
+}
+
+func Test_Collector_collectRuntimeMetrics_windowAggregates(t *testing.T) {
+	t.Parallel()
+
+	acctName := "acct"
+	till := time.Now().UTC()
+	since := till.Add(-30 * time.Second)
+
+	f := newFetcherMock()
+	c, err := NewCollector(f, []string{acctName}, WithExporter(newExporterMock()), WithRuntimeWindowAggregates(true))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+	col := c.(*collector)
+	f.fetchRuntimePointsFn = func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) (<-chan fetcher.EngineRuntimePoint, <-chan error) {
+		ch := make(chan fetcher.EngineRuntimePoint, 3)
+		// NULL values are not aggregated
+		memory := []sql.NullFloat64{{Valid: true, Float64: 50}, {}, {}}
+		for i, cpu := range []float64{20, 90, 10} {
+			ch <- fetcher.EngineRuntimePoint{
+				EngineName: "engine1",
+				EventTime:  sql.Null[time.Time]{Valid: true, V: since.Add(time.Duration(i+1) * time.Second)},
+				CPUUsed:    sql.NullFloat64{Valid: true, Float64: cpu},
+				MemoryUsed: memory[i],
+			}
+		}
+		close(ch)
+
+		return ch, closedErrCh()
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	col.collectRuntimeMetrics(context.Background(), wg, acctName, []fetcher.Engine{{Name: "engine1", Status: "RUNNING"}}, since, till)
+	wg.Wait()
+
+	sm, err := col.producer.Produce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, sm, 1)
+
+	// every sample is reported, while the window aggregates are reported at the time of the last one
+	values := make(map[string][]float64)
+	for _, m := range sm[0].Metrics {
+		gauge, ok := m.Data.(metricdata.Gauge[float64])
+		if !ok {
+			continue
+		}
+
+		for _, point := range gauge.DataPoints {
+			values[m.Name] = append(values[m.Name], point.Value)
+		}
+		require.Equal(t, since.Add(3*time.Second), gauge.DataPoints[len(gauge.DataPoints)-1].Time)
+	}
+
+	require.Equal(t, map[string][]float64{
+		"firebolt.engine.cpu.utilization":        {20, 90, 10},
+		"firebolt.engine.cpu.utilization.min":    {10},
+		"firebolt.engine.cpu.utilization.max":    {90},
+		"firebolt.engine.cpu.utilization.avg":    {40},
+		"firebolt.engine.memory.utilization":     {50, 0, 0},
+		"firebolt.engine.memory.utilization.min": {50},
+		"firebolt.engine.memory.utilization.max": {50},
+		"firebolt.engine.memory.utilization.avg": {50},
+		"firebolt.engine.disk.utilization":       {0, 0, 0},
+		"firebolt.engine.cache.hit_ratio":        {0, 0, 0},
+	}, values)
+
+	// once the samples are exported, only the latest one is reported again
+	sm, err = col.producer.Produce(context.Background())
+	require.NoError(t, err)
+
+	for _, m := range sm[0].Metrics {
+		if m.Name == "firebolt.engine.cpu.utilization" {
+			require.Equal(t, []metricdata.DataPoint[float64]{
+				{Attributes: runtimeAttributes(acctName, fetcher.EngineRuntimePoint{EngineName: "engine1"}), Time: since.Add(3 * time.Second), Value: 10},
+			}, m.Data.(metricdata.Gauge[float64]).DataPoints)
+		}
+	}
+}
+
+func Test_Collector_collectRuntimeMetrics_clusters(t *testing.T) {
+	t.Parallel()
+
+	acctName := "acct"
+	till := time.Now().UTC()
+	since := till.Add(-30 * time.Second)
+
+	f := newFetcherMock()
+	c, err := NewCollector(f, []string{acctName}, WithExporter(newExporterMock()))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+	col := c.(*collector)
+	f.fetchRuntimePointsFn = func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) (<-chan fetcher.EngineRuntimePoint, <-chan error) {
+		ch := make(chan fetcher.EngineRuntimePoint, 2)
+		for i, cluster := range []string{"cluster1", "cluster2"} {
+			ch <- fetcher.EngineRuntimePoint{
+				EngineName:    "engine1",
+				EngineStatus:  "RUNNING",
+				EngineCluster: sql.NullString{Valid: true, String: cluster},
+				EventTime:     sql.Null[time.Time]{Valid: true, V: since.Add(time.Second)},
+				CPUUsed:       sql.NullFloat64{Valid: true, Float64: float64(10 * (i + 1))},
+			}
+		}
+		close(ch)
+
+		return ch, closedErrCh()
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	col.collectRuntimeMetrics(context.Background(), wg, acctName, []fetcher.Engine{{Name: "engine1", Status: "RUNNING"}}, since, till)
+	wg.Wait()
+
+	sm, err := col.producer.Produce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, sm, 1)
+
+	values := make(map[attribute.Distinct]float64)
+	for _, m := range sm[0].Metrics {
+		if m.Name != "firebolt.engine.cpu.utilization" {
+			continue
+		}
+
+		for _, point := range m.Data.(metricdata.Gauge[float64]).DataPoints {
+			values[point.Attributes.Equivalent()] = point.Value
+		}
+	}
+
+	// each cluster is reported as a separate series
+	clusterAttrs := func(cluster string) attribute.Distinct {
+		attrs := attribute.NewSet(
+			attribute.String("firebolt.account.name", acctName),
+			attribute.String("firebolt.engine.name", "engine1"),
+			attribute.String("firebolt.engine.status", "RUNNING"),
+			attribute.String("firebolt.engine.cluster", cluster),
+		)
+		return attrs.Equivalent()
+	}
+	require.Equal(t, map[attribute.Distinct]float64{
+		clusterAttrs("cluster1"): 10,
+		clusterAttrs("cluster2"): 20,
+	}, values)
+}
+
+func Test_Collector_forgetStaleSeries(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewCollector(newFetcherMock(), []string{"acct1", "acct2"}, WithExporter(newExporterMock()))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+	col := c.(*collector)
+	now := time.Now().UTC()
+	for _, mp := range []struct {
+		account string
+		point   fetcher.EngineRuntimePoint
+	}{
+		{account: "acct1", point: fetcher.EngineRuntimePoint{EngineName: "engine1", EngineStatus: "RUNNING"}},
+		{account: "acct1", point: fetcher.EngineRuntimePoint{EngineName: "engine1", EngineStatus: "RESIZING"}},
+		{account: "acct1", point: fetcher.EngineRuntimePoint{EngineName: "engine2", EngineStatus: "RUNNING"}},
+		{account: "acct2", point: fetcher.EngineRuntimePoint{EngineName: "engine2", EngineStatus: "RUNNING"}},
+	} {
+		col.recordRuntimePoint(now, runtimeAttributes(mp.account, mp.point), mp.point)
+	}
+	col.recordQueryHistoryPoint("acct1", now, fetcher.QueryHistoryPoint{EngineName: "engine2", EngineStatus: "RUNNING"})
+
+	// engine2 of acct1 has stopped, engine1 is not resizing anymore
+	col.forgetStaleSeries("acct1", []fetcher.Engine{{Name: "engine1", Status: "RUNNING"}})
+
+	// the counters of engine2 are reported once more, so that the values recorded before it stopped are not lost
+	sm, err := col.producer.Produce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, sm, 2)
+	require.Equal(t, "firebolt.engine.query_history", sm[1].Scope.Name)
+
+	sm, err = col.producer.Produce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, sm, 1)
+	require.Equal(t, "firebolt.engine.runtime", sm[0].Scope.Name)
+
+	for _, m := range sm[0].Metrics {
+		gauge, ok := m.Data.(metricdata.Gauge[float64])
+		if !ok {
+			continue
+		}
+
+		var series []string
+		for _, point := range gauge.DataPoints {
+			account, _ := point.Attributes.Value("firebolt.account.name")
+			engine, _ := point.Attributes.Value("firebolt.engine.name")
+			status, _ := point.Attributes.Value("firebolt.engine.status")
+			series = append(series, account.AsString()+"/"+engine.AsString()+"/"+status.AsString())
+		}
+
+		require.ElementsMatch(t, []string{"acct1/engine1/RUNNING", "acct2/engine2/RUNNING"}, series, m.Name)
+	}
+}
+
+func Test_Collector_recordQueryHistoryPoint_exporterQueries(t *testing.T) {
+	t.Parallel()
+
+	for _, include := range []bool{false, true} {
+		c, err := NewCollector(newFetcherMock(), []string{"acct"}, WithExporter(newExporterMock()), WithExporterQueries(include))
+		require.NoError(t, err)
+		t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+		col := c.(*collector)
+		now := time.Now().UTC()
+
+		col.recordQueryHistoryPoint("acct", now, fetcher.QueryHistoryPoint{
+			EngineName:           "engine1",
+			QueryID:              sql.NullString{Valid: true, String: "q1"},
+			DurationMicroSeconds: sql.NullInt64{Valid: true, Int64: 2000000},
+			ScannedBytes:         sql.NullInt64{Valid: true, Int64: 100},
+			QueryLabel:           sql.NullString{Valid: true, String: "otel-exporter"},
+			Exporter:             true,
+		})
+		col.recordQueryHistoryPoint("acct", now, fetcher.QueryHistoryPoint{
+			EngineName:   "engine1",
+			QueryID:      sql.NullString{Valid: true, String: "q2"},
+			ScannedBytes: sql.NullInt64{Valid: true, Int64: 10},
+		})
+
+		sm, err := col.producer.Produce(context.Background())
+		require.NoError(t, err)
+		require.Len(t, sm, 1)
+
+		values := make(map[string]float64)
+		for _, m := range sm[0].Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				values[m.Name] = float64(data.DataPoints[0].Value)
+			case metricdata.Sum[float64]:
+				values[m.Name] = data.DataPoints[0].Value
+			}
+		}
+
+		// the exporter's own query is reported in the query history metrics only if configured
+		expectedScannedBytes := 10.0
+		if include {
+			expectedScannedBytes = 110
+		}
+
+		require.Equal(t, expectedScannedBytes, values["firebolt.query.scanned.bytes"])
+		require.Equal(t, 1.0, values["firebolt.exporter.queries"])
+		require.Equal(t, 2.0, values["firebolt.exporter.query.duration"])
+		require.Equal(t, 100.0, values["firebolt.exporter.scanned.bytes"])
+	}
+}
+
+func Test_Collector_recordQueryHistoryPoint_errors(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewCollector(newFetcherMock(), []string{"acct"}, WithExporter(newExporterMock()))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+	col := c.(*collector)
+	now := time.Now().UTC()
+
+	for i, q := range []struct{ status, errorMessage string }{
+		{status: "ENDED_SUCCESSFULLY"},
+		{status: "EXECUTION_ERROR", errorMessage: "Out of memory"},
+		{status: "EXECUTION_ERROR", errorMessage: "Division by zero"},
+		{status: "PARSE_ERROR", errorMessage: "syntax error at or near \"SELEC\""},
+	} {
+		col.recordQueryHistoryPoint("acct", now, fetcher.QueryHistoryPoint{
+			EngineName:   "engine1",
+			QueryID:      sql.NullString{Valid: true, String: fmt.Sprintf("q%d", i)},
+			Status:       sql.NullString{Valid: true, String: q.status},
+			ErrorMessage: sql.NullString{Valid: q.errorMessage != "", String: q.errorMessage},
+		})
+	}
+
+	sm, err := col.producer.Produce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, sm, 1)
+
+	counts := make(map[string]int64)
+	errorCounts := make(map[string]int64)
+	fingerprintCounts := make(map[string]int64)
+	for _, m := range sm[0].Metrics {
+		switch m.Name {
+		case "firebolt.query.count":
+			for _, point := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				status, _ := point.Attributes.Value("firebolt.query.status")
+				counts[status.AsString()] = point.Value
+			}
+		case "firebolt.query.errors":
+			for _, point := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				errorClass, _ := point.Attributes.Value("firebolt.query.error.class")
+				errorCounts[errorClass.AsString()] += point.Value
+
+				fingerprint, _ := point.Attributes.Value("firebolt.query.error.fingerprint")
+				fingerprintCounts[fingerprint.AsString()] += point.Value
+			}
+		}
+	}
+
+	require.Equal(t, map[string]int64{"ENDED_SUCCESSFULLY": 1, "EXECUTION_ERROR": 2, "PARSE_ERROR": 1}, counts)
+	require.Equal(t, map[string]int64{"execution": 2, "parse": 1}, errorCounts)
+	require.Equal(t, map[string]int64{"out_of_memory": 1, "other": 1, "syntax_error": 1}, fingerprintCounts)
+}
+
+func Test_queryErrorClass(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		status       string
+		errorMessage string
+		class        string
+		failed       bool
+	}{
+		{name: "succeeded", status: "ENDED_SUCCESSFULLY"},
+		{name: "canceled", status: "CANCELED_EXECUTION", errorMessage: "query was canceled"},
+		{name: "parse error", status: "PARSE_ERROR", errorMessage: "syntax error", class: "parse", failed: true},
+		{name: "execution error", status: "EXECUTION_ERROR", class: "execution", failed: true},
+		{name: "unknown status with error", status: "FAILED", errorMessage: "out of memory", class: "unknown", failed: true},
+		{name: "unknown status without error", status: "FAILED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			class, failed := queryErrorClass(fetcher.QueryHistoryPoint{
+				Status:       sql.NullString{Valid: true, String: tt.status},
+				ErrorMessage: sql.NullString{Valid: tt.errorMessage != "", String: tt.errorMessage},
+			})
+			require.Equal(t, tt.failed, failed)
+			require.Equal(t, tt.class, class)
+		})
+	}
+}
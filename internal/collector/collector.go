@@ -2,13 +2,21 @@ package collector
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
 	"go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/firebolt-db/otel-exporter/internal/errorclass"
 	"github.com/firebolt-db/otel-exporter/internal/fetcher"
+	"github.com/firebolt-db/otel-exporter/internal/state"
 )
 
 // Collector defines an interface that the collector should implement.
@@ -17,21 +25,95 @@ type Collector interface {
 	Close(ctx context.Context) error
 	// Start is a blocking function which should run the main collector's process
 	Start(ctx context.Context, interval time.Duration) error
+	// Backfill is a blocking function which should collect and export the metrics of a past time range
+	Backfill(ctx context.Context, from, to time.Time, step time.Duration) error
 }
 
 // collector is an implementation of Collector interface.
 type collector struct {
 	exporter      metric.Exporter
 	meterProvider *metric.MeterProvider
-	fetcher       fetcher.Fetcher
+	// producer reports the engine metrics, which are recorded with the timestamps reported by Firebolt.
+	producer *producer
+	fetcher  fetcher.Fetcher
 
 	accounts []string
+	// accountConcurrency limits how many accounts are collected at once.
+	accountConcurrency int
 
 	runtimeMetrics      *runtimeMetrics
 	queryHistoryMetrics *queryHistoryMetrics
 	exporterMetrics     *exporterMetrics
 
-	lastCollectedTime time.Time
+	// lastCycleTime is the start of the first collection cycle. It's the window start of the engines,
+	// which are seen for the first time.
+	lastCycleTime time.Time
+	// overrunPolicy defines how the cycles, which run past the boundary of the next one, are handled.
+	overrunPolicy OverrunPolicy
+	// runtimeSchedule and queryHistorySchedule define when each source of the metrics is collected.
+	runtimeSchedule      Schedule
+	queryHistorySchedule Schedule
+
+	// enginesMu guards engines, which keeps the running engines of each account as of the last successful fetch.
+	enginesMu sync.Mutex
+	engines   map[string][]fetcher.Engine
+
+	// runtimeProgress and queryHistoryProgress keep the watermarks of each engine.
+	runtimeProgress      *progress
+	queryHistoryProgress *progress
+
+	// includeExporterQueries defines whether the queries of the exporter itself are included in the query
+	// history metrics. They are reported in the exporter's own metrics either way.
+	includeExporterQueries bool
+
+	// errorClassifier assigns the fingerprints to the error messages of the failed queries.
+	errorClassifier *errorclass.Classifier
+
+	// queryLabeler tells the query label attribute of the query history metrics, if it's enabled.
+	queryLabeler *queryLabeler
+
+	// queryFingerprintsTopK is the number of the heaviest query fingerprints of each engine, which are reported
+	// in each cycle. Zero means that the query fingerprints are not reported.
+	queryFingerprintsTopK int
+
+	// logExporter exports the log records of the queries. loggerProvider is only set, if it's set.
+	logExporter    sdklog.Exporter
+	loggerProvider *sdklog.LoggerProvider
+
+	// queryLogs defines how the queries are emitted as log records. queryLogger is only set, if they are enabled
+	// and exported.
+	queryLogs   QueryLogs
+	queryLogger log.Logger
+
+	// slowQueries defines which queries are slow and how they are reported. slowQueryLogger is only set, if the
+	// slow queries are enabled and emitted as log records.
+	slowQueries     SlowQueries
+	slowQueryLogger log.Logger
+	// slowQueryWriterMu guards the writer of the slow queries.
+	slowQueryWriterMu sync.Mutex
+
+	// spanExporter exports the spans of the queries. tracerProvider and queryTracer are only set, if it's set.
+	spanExporter   sdktrace.SpanExporter
+	tracerProvider *sdktrace.TracerProvider
+	queryTracer    trace.Tracer
+
+	// queryHistoryLookback defines how far behind the collection window the query history is read again.
+	queryHistoryLookback time.Duration
+
+	// runtimeWindowAggregates defines whether the runtime samples are aggregated within the collection window.
+	runtimeWindowAggregates bool
+
+	// stateStore keeps the query history progress between the runs of the exporter.
+	stateStore state.Store
+	// maxCatchUp limits how far back the collection of an engine is resumed from its watermark.
+	maxCatchUp time.Duration
+	// cycleTimeout limits how long a single collection cycle runs. Zero means no limit.
+	cycleTimeout time.Duration
+
+	// serverTime defines whether the collection windows are based on the time of Firebolt rather than the local
+	// clock, which is synced with it at the start of each cycle.
+	serverTime bool
+	clock      clock
 
 	exportInterval time.Duration
 }
@@ -39,10 +121,23 @@ type collector struct {
 // NewCollector creates a new instance of the [Collector] that will observe a list of accounts.
 func NewCollector(fetcher fetcher.Fetcher, accounts []string, options ...Option) (Collector, error) {
 	c := &collector{
-		fetcher:           fetcher,
-		accounts:          accounts,
-		lastCollectedTime: time.Now().UTC(), // start observing metrics from current timestamp.
-		exportInterval:    15 * time.Second, // default export interval, which defines how often metrics will be pushed to collector.
+		fetcher:            fetcher,
+		accounts:           accounts,
+		accountConcurrency: 1,                // collect accounts one after another, unless configured otherwise.
+		lastCycleTime:      time.Now().UTC(), // start observing metrics from current timestamp.
+		exportInterval:     15 * time.Second, // default export interval, which defines how often metrics will be pushed to collector.
+		stateStore:         state.NewMemoryStore(),
+		maxCatchUp:         time.Hour,
+		overrunPolicy:      OverrunMerge,
+
+		runtimeSchedule:      Schedule{Enabled: true},
+		queryHistorySchedule: Schedule{Enabled: true},
+
+		runtimeProgress:      newProgress(),
+		queryHistoryProgress: newProgress(),
+
+		errorClassifier: errorclass.NewClassifier(errorclass.DefaultRules()...),
+		queryLabeler:    newQueryLabeler(QueryLabels{}),
 	}
 
 	for _, opt := range options {
@@ -54,8 +149,10 @@ func NewCollector(fetcher fetcher.Fetcher, accounts []string, options ...Option)
 		return nil, fmt.Errorf("must provide either a grpc exporter or a http exporter")
 	}
 
+	c.producer = newProducer(c.exporter.Temporality)
+
 	var err error
-	c.meterProvider, err = newMeterProvider(c.exporter, c.exportInterval)
+	c.meterProvider, err = newMeterProvider(c.exporter, c.exportInterval, c.producer)
 	if err != nil {
 		return nil, err
 	}
@@ -65,15 +162,49 @@ func NewCollector(fetcher fetcher.Fetcher, accounts []string, options ...Option)
 		return nil, err
 	}
 
+	if c.logExporter != nil {
+		c.loggerProvider, err = newLoggerProvider(c.logExporter)
+		if err != nil {
+			return nil, err
+		}
+
+		if c.queryLogs.Enabled {
+			c.queryLogger = c.loggerProvider.Logger("firebolt.engine.query_history")
+		}
+
+		if c.slowQueries.Enabled && c.slowQueries.Writer == nil {
+			c.slowQueryLogger = c.loggerProvider.Logger("firebolt.engine.slow_queries")
+		}
+	}
+
+	if c.spanExporter != nil {
+		c.tracerProvider, err = newTracerProvider(c.spanExporter)
+		if err != nil {
+			return nil, err
+		}
+
+		c.queryTracer = c.tracerProvider.Tracer("firebolt.engine.query_history")
+	}
+
 	// set the meter provider as a global meter provider
 	otel.SetMeterProvider(c.meterProvider)
 
 	return c, nil
 }
 
-// Close will close allocated meter provider.
+// Close will close allocated meter provider, and logger and tracer providers if any.
 func (c *collector) Close(ctx context.Context) error {
-	return c.meterProvider.Shutdown(ctx)
+	err := c.meterProvider.Shutdown(ctx)
+
+	if c.loggerProvider != nil {
+		err = errors.Join(err, c.loggerProvider.Shutdown(ctx))
+	}
+
+	if c.tracerProvider != nil {
+		err = errors.Join(err, c.tracerProvider.Shutdown(ctx))
+	}
+
+	return err
 }
 
 // setupMetrics prepares all the metrics reported by the collector.
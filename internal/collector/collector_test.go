@@ -44,6 +44,7 @@ func Test_NewCollector(t *testing.T) {
 
 	require.NotNil(t, c.exporterMetrics)
 	require.NotNil(t, c.exporterMetrics.duration)
+	require.NotNil(t, c.exporterMetrics.watermarkLag)
 
 	require.NoError(t, col.Close(context.Background()))
 }
@@ -58,8 +59,10 @@ func Test_NewCollector_missing_exporter(t *testing.T) {
 
 type fetcherMock struct {
 	fetchEnginesFn            func(ctx context.Context, accountName string) ([]fetcher.Engine, error)
-	fetchRuntimePointsFn      func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) <-chan fetcher.EngineRuntimePoint
-	fetchQueryHistoryPointsFn func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) <-chan fetcher.QueryHistoryPoint
+	fetchServerTimeFn         func(ctx context.Context, accountName string) (time.Time, error)
+	fetchRuntimePointsFn      func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) (<-chan fetcher.EngineRuntimePoint, <-chan error)
+	fetchQueryHistoryPointsFn func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) (<-chan fetcher.QueryHistoryPoint, <-chan error)
+	closeFn                   func() error
 }
 
 func newFetcherMock() *fetcherMock {
@@ -67,24 +70,36 @@ func newFetcherMock() *fetcherMock {
 		fetchEnginesFn: func(ctx context.Context, accountName string) ([]fetcher.Engine, error) {
 			panic("default FetchEngines")
 		},
-		fetchRuntimePointsFn: func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) <-chan fetcher.EngineRuntimePoint {
+		fetchServerTimeFn: func(ctx context.Context, accountName string) (time.Time, error) {
+			panic("default FetchServerTime")
+		},
+		fetchRuntimePointsFn: func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) (<-chan fetcher.EngineRuntimePoint, <-chan error) {
 			panic("default FetchRuntimePoints")
 		},
-		fetchQueryHistoryPointsFn: func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) <-chan fetcher.QueryHistoryPoint {
+		fetchQueryHistoryPointsFn: func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) (<-chan fetcher.QueryHistoryPoint, <-chan error) {
 			panic("default FetchQueryHistoryPoints")
 		},
+		closeFn: func() error {
+			return nil
+		},
 	}
 }
 
 func (m *fetcherMock) FetchEngines(ctx context.Context, accountName string) ([]fetcher.Engine, error) {
 	return m.fetchEnginesFn(ctx, accountName)
 }
-func (m *fetcherMock) FetchRuntimePoints(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) <-chan fetcher.EngineRuntimePoint {
+func (m *fetcherMock) FetchServerTime(ctx context.Context, accountName string) (time.Time, error) {
+	return m.fetchServerTimeFn(ctx, accountName)
+}
+func (m *fetcherMock) FetchRuntimePoints(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) (<-chan fetcher.EngineRuntimePoint, <-chan error) {
 	return m.fetchRuntimePointsFn(ctx, account, engines, since, till)
 }
-func (m *fetcherMock) FetchQueryHistoryPoints(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) <-chan fetcher.QueryHistoryPoint {
+func (m *fetcherMock) FetchQueryHistoryPoints(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) (<-chan fetcher.QueryHistoryPoint, <-chan error) {
 	return m.fetchQueryHistoryPointsFn(ctx, account, engines, since, till)
 }
+func (m *fetcherMock) Close() error {
+	return m.closeFn()
+}
 
 type exporterMock struct {
 	temporalityFn api.TemporalitySelector
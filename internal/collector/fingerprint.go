@@ -0,0 +1,223 @@
+package collector
+
+import (
+	"cmp"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// otherQueryFingerprint is the fingerprint of the queries, which are not among the heaviest ones of the engine.
+const otherQueryFingerprint = "other"
+
+// queryFingerprint returns the fingerprint of the query shape, which is the same for the queries, which only differ
+// in their literals, comments, whitespace or letter case. It's the FNV-1a hash of the normalized query text.
+func queryFingerprint(queryText string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(normalizeQuery(queryText)))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// normalizeQuery returns the query text with the string and numeric literals replaced by `?`, lists of literals
+// collapsed into a single one, comments stripped, whitespace collapsed and the letters lowercased. Quoted identifiers
+// are kept as they are.
+func normalizeQuery(queryText string) string {
+	var sb strings.Builder
+	sb.Grow(len(queryText))
+
+	// space tells whether a whitespace is pending, so that it's written once before the next token. The punctuation
+	// is written without the whitespace around it, so that `a=1` and `a = 1` are the same.
+	space, punctuation := false, false
+	write := func(s string) {
+		if space && !punctuation && sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		space, punctuation = false, false
+		sb.WriteString(s)
+	}
+
+	runes := []rune(queryText)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			space = true
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			// the line comment lasts until the end of the line.
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			space = true
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			// the block comment lasts until the closing `*/`.
+			i += 2
+			for i < len(runes) && !(runes[i] == '*' && i+1 < len(runes) && runes[i+1] == '/') {
+				i++
+			}
+			i++
+			space = true
+		case literalStart(runes, i):
+			i = literalEnd(runes, i)
+			write("?")
+		case r == '"':
+			end := quotedIdentifierEnd(runes, i)
+			write(string(runes[i : end+1]))
+			i = end
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			start := i
+			for i+1 < len(runes) && (unicode.IsLetter(runes[i+1]) || unicode.IsDigit(runes[i+1]) || runes[i+1] == '_') {
+				i++
+			}
+			write(strings.ToLower(string(runes[start : i+1])))
+		default:
+			sb.WriteRune(r)
+			space, punctuation = false, true
+		}
+	}
+
+	return collapseLiteralLists(sb.String())
+}
+
+// literalStart tells whether a string or numeric literal starts at position i. The digits, which continue a word,
+// are not a literal.
+func literalStart(runes []rune, i int) bool {
+	return runes[i] == '\'' || (unicode.IsDigit(runes[i]) && !precededByWord(runes, i))
+}
+
+// literalEnd returns the position of the last rune of the string or numeric literal, which starts at position i.
+func literalEnd(runes []rune, i int) int {
+	if runes[i] != '\'' {
+		for i+1 < len(runes) && (unicode.IsDigit(runes[i+1]) || runes[i+1] == '.') {
+			i++
+		}
+		return i
+	}
+
+	// quotes are escaped by doubling them within a string literal.
+	for i++; i < len(runes); i++ {
+		if runes[i] != '\'' {
+			continue
+		}
+
+		if i+1 < len(runes) && runes[i+1] == '\'' {
+			i++
+			continue
+		}
+
+		return i
+	}
+
+	return len(runes) - 1
+}
+
+// quotedIdentifierEnd returns the position of the closing quote of the quoted identifier, which starts at position i,
+// or the last position, if the identifier is not closed.
+func quotedIdentifierEnd(runes []rune, i int) int {
+	for i++; i < len(runes) && runes[i] != '"'; i++ {
+	}
+	return min(i, len(runes)-1)
+}
+
+// precededByWord tells whether the rune at position i continues a word, such as the digits of the identifier `t1`.
+func precededByWord(runes []rune, i int) bool {
+	if i == 0 {
+		return false
+	}
+
+	prev := runes[i-1]
+	return unicode.IsLetter(prev) || unicode.IsDigit(prev) || prev == '_'
+}
+
+// collapseLiteralLists replaces the lists of literals, such as `(?,?,?)`, with a single literal, so that the queries
+// filtering by a different number of values have the same fingerprint.
+func collapseLiteralLists(normalized string) string {
+	for strings.Contains(normalized, "?,?") {
+		normalized = strings.ReplaceAll(normalized, "?,?", "?")
+	}
+	return normalized
+}
+
+// fingerprintStats is the load of the queries of a single fingerprint.
+type fingerprintStats struct {
+	count        int64
+	duration     float64
+	scannedBytes int64
+}
+
+// fingerprintTracker aggregates the load of the queries of each engine by their fingerprints within a cycle,
+// so that only the heaviest fingerprints are reported.
+type fingerprintTracker struct {
+	mu      sync.Mutex
+	engines map[string]map[string]*fingerprintStats
+}
+
+func newFingerprintTracker() *fingerprintTracker {
+	return &fingerprintTracker{
+		engines: make(map[string]map[string]*fingerprintStats),
+	}
+}
+
+// add adds the load of a single query of the engine.
+func (t *fingerprintTracker) add(engineName, fingerprint string, duration float64, scannedBytes int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fingerprints, ok := t.engines[engineName]
+	if !ok {
+		fingerprints = make(map[string]*fingerprintStats)
+		t.engines[engineName] = fingerprints
+	}
+
+	stats, ok := fingerprints[fingerprint]
+	if !ok {
+		stats = &fingerprintStats{}
+		fingerprints[fingerprint] = stats
+	}
+
+	stats.count++
+	stats.duration += duration
+	stats.scannedBytes += scannedBytes
+}
+
+// top returns the load of the k heaviest fingerprints of each engine, as told by the total duration of their queries,
+// and the load of the rest of them summed up as other.
+func (t *fingerprintTracker) top(k int) map[string]map[string]fingerprintStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make(map[string]map[string]fingerprintStats, len(t.engines))
+	for engineName, fingerprints := range t.engines {
+		// the scanned bytes and the fingerprint break the ties, so that the result doesn't depend on the map order.
+		sorted := slices.SortedFunc(maps.Keys(fingerprints), func(a, b string) int {
+			return cmp.Or(
+				cmp.Compare(fingerprints[b].duration, fingerprints[a].duration),
+				cmp.Compare(fingerprints[b].scannedBytes, fingerprints[a].scannedBytes),
+				strings.Compare(a, b),
+			)
+		})
+
+		top := make(map[string]fingerprintStats, min(k, len(sorted))+1)
+		for i, fingerprint := range sorted {
+			stats := fingerprints[fingerprint]
+			if i < k {
+				top[fingerprint] = *stats
+				continue
+			}
+
+			other := top[otherQueryFingerprint]
+			other.count += stats.count
+			other.duration += stats.duration
+			other.scannedBytes += stats.scannedBytes
+			top[otherQueryFingerprint] = other
+		}
+
+		result[engineName] = top
+	}
+
+	return result
+}
@@ -0,0 +1,235 @@
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/firebolt-db/otel-exporter/internal/fetcher"
+)
+
+func Test_normalizeQuery(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		queryText  string
+		normalized string
+	}{
+		{
+			queryText:  "SELECT *  FROM orders\n\tWHERE id = 42 AND name = 'it''s'",
+			normalized: "select*from orders where id=? and name=?",
+		},
+		{
+			queryText:  "-- dashboard\nselect * from orders where id=7 and name='x' /* filter */",
+			normalized: "select*from orders where id=? and name=?",
+		},
+		{
+			queryText:  "SELECT * FROM t1 WHERE price > 1.5 AND id IN (1, 2, 3)",
+			normalized: "select*from t1 where price>? and id in(?)",
+		},
+		{
+			queryText:  `SELECT "Name" FROM "Orders"`,
+			normalized: `select "Name" from "Orders"`,
+		},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.normalized, normalizeQuery(tt.queryText), tt.queryText)
+	}
+}
+
+func Test_queryFingerprint(t *testing.T) {
+	t.Parallel()
+
+	fingerprint := queryFingerprint("SELECT * FROM orders WHERE id IN (1, 2)")
+	require.Len(t, fingerprint, 16)
+
+	// the queries of the same shape have the same fingerprint
+	require.Equal(t, fingerprint, queryFingerprint("select *\nfrom orders where id in (3,4,5) -- retry"))
+	require.NotEqual(t, fingerprint, queryFingerprint("SELECT * FROM customers WHERE id IN (1, 2)"))
+}
+
+func Test_fingerprintTracker_top(t *testing.T) {
+	t.Parallel()
+
+	tracker := newFingerprintTracker()
+	tracker.add("engine1", "heavy", 10, 100)
+	tracker.add("engine1", "heavy", 20, 100)
+	tracker.add("engine1", "medium", 5, 1000)
+	tracker.add("engine1", "light", 1, 10)
+	tracker.add("engine1", "lighter", 0.5, 10)
+	tracker.add("engine2", "light", 1, 10)
+
+	require.Equal(t, map[string]map[string]fingerprintStats{
+		"engine1": {
+			"heavy":  {count: 2, duration: 30, scannedBytes: 200},
+			"medium": {count: 1, duration: 5, scannedBytes: 1000},
+			"other":  {count: 2, duration: 1.5, scannedBytes: 20},
+		},
+		"engine2": {
+			"light": {count: 1, duration: 1, scannedBytes: 10},
+		},
+	}, tracker.top(2))
+}
+
+func Test_Collector_collectQueryHistoryMetrics_fingerprints(t *testing.T) {
+	t.Parallel()
+
+	acctName := "acct"
+	till := time.Now().UTC()
+	since := till.Add(-time.Minute)
+
+	f := newFetcherMock()
+	c, err := NewCollector(f, []string{acctName}, WithExporter(newExporterMock()), WithQueryFingerprintsTopK(1))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+	col := c.(*collector)
+	f.fetchQueryHistoryPointsFn = func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) (<-chan fetcher.QueryHistoryPoint, <-chan error) {
+		ch := make(chan fetcher.QueryHistoryPoint, 3)
+		for i, q := range []struct {
+			text     string
+			duration int64
+		}{
+			{text: "SELECT * FROM orders WHERE id = 1", duration: 2000000},
+			{text: "SELECT * FROM orders WHERE id = 2", duration: 3000000},
+			{text: "SELECT count(*) FROM customers", duration: 1000000},
+		} {
+			ch <- fetcher.QueryHistoryPoint{
+				EngineName:           "engine1",
+				QueryID:              sql.NullString{Valid: true, String: string(rune('a' + i))},
+				SubmittedTime:        sql.Null[time.Time]{Valid: true, V: since.Add(time.Second)},
+				QueryText:            sql.NullString{Valid: true, String: q.text},
+				DurationMicroSeconds: sql.NullInt64{Valid: true, Int64: q.duration},
+				ScannedBytes:         sql.NullInt64{Valid: true, Int64: 100},
+			}
+		}
+		close(ch)
+
+		return ch, closedErrCh()
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	col.collectQueryHistoryMetrics(context.Background(), wg, acctName, []fetcher.Engine{{Name: "engine1", Status: "RUNNING"}}, since, till)
+	wg.Wait()
+
+	sm, err := col.producer.Produce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, sm, 1)
+
+	counts := make(map[string]int64)
+	durations := make(map[string]float64)
+	for _, m := range sm[0].Metrics {
+		switch m.Name {
+		case "firebolt.query.fingerprint.count":
+			for _, point := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				fingerprint, _ := point.Attributes.Value("firebolt.query.fingerprint")
+				counts[fingerprint.AsString()] = point.Value
+				require.Equal(t, till, point.Time)
+			}
+		case "firebolt.query.fingerprint.duration":
+			for _, point := range m.Data.(metricdata.Sum[float64]).DataPoints {
+				fingerprint, _ := point.Attributes.Value("firebolt.query.fingerprint")
+				durations[fingerprint.AsString()] = point.Value
+			}
+		}
+	}
+
+	ordersFingerprint := queryFingerprint("SELECT * FROM orders WHERE id = 1")
+	require.Equal(t, map[string]int64{ordersFingerprint: 2, "other": 1}, counts)
+	require.Equal(t, map[string]float64{ordersFingerprint: 5, "other": 1}, durations)
+}
+
+func Test_Collector_forgetStaleSeries_fingerprints(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewCollector(newFetcherMock(), []string{"acct"}, WithExporter(newExporterMock()), WithQueryFingerprintsTopK(1))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+	col := c.(*collector)
+	till := time.Now().UTC()
+
+	fingerprints := newFingerprintTracker()
+	fingerprints.add("engine1", queryFingerprint("SELECT 1"), 1, 100)
+	col.recordQueryFingerprints("acct", []fetcher.Engine{{Name: "engine1", Status: "RUNNING"}}, till, fingerprints)
+
+	fingerprintSeries := func() int {
+		sm, err := col.producer.Produce(context.Background())
+		require.NoError(t, err)
+
+		series := 0
+		for _, scope := range sm {
+			for _, m := range scope.Metrics {
+				if m.Name == "firebolt.query.fingerprint.count" {
+					series += len(m.Data.(metricdata.Sum[int64]).DataPoints)
+				}
+			}
+		}
+		return series
+	}
+
+	// the series have no status, so they are kept while the engine is running
+	col.forgetStaleSeries("acct", []fetcher.Engine{{Name: "engine1", Status: "RUNNING"}})
+	require.Equal(t, 1, fingerprintSeries())
+	require.Equal(t, 1, fingerprintSeries())
+
+	// and dropped once the engine stops
+	col.forgetStaleSeries("acct", nil)
+	require.Equal(t, 0, fingerprintSeries())
+}
+
+func Test_Collector_recordQueryFingerprints_cycles(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewCollector(newFetcherMock(), []string{"acct"}, WithExporter(newExporterMock()), WithQueryFingerprintsTopK(1))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+	col := c.(*collector)
+	engines := []fetcher.Engine{{Name: "engine1", Status: "RUNNING"}}
+	till := time.Now().UTC()
+
+	fingerprintSeries := func() map[string]int64 {
+		sm, err := col.producer.Produce(context.Background())
+		require.NoError(t, err)
+
+		series := make(map[string]int64)
+		for _, scope := range sm {
+			for _, m := range scope.Metrics {
+				if m.Name != "firebolt.query.fingerprint.count" {
+					continue
+				}
+
+				for _, point := range m.Data.(metricdata.Sum[int64]).DataPoints {
+					fingerprint, _ := point.Attributes.Value("firebolt.query.fingerprint")
+					series[fingerprint.AsString()] = point.Value
+				}
+			}
+		}
+		return series
+	}
+
+	// each cycle has a different heaviest fingerprint, and only the one of the latest cycle is exported.
+	for i := range 20 {
+		heaviest := queryFingerprint(fmt.Sprintf("SELECT * FROM orders_%d", i))
+
+		fingerprints := newFingerprintTracker()
+		fingerprints.add("engine1", heaviest, 2, 100)
+		fingerprints.add("engine1", queryFingerprint(fmt.Sprintf("SELECT * FROM customers_%d", i)), 1, 100)
+		col.recordQueryFingerprints("acct", engines, till.Add(time.Duration(i)*time.Minute), fingerprints)
+
+		require.Equal(t, map[string]int64{heaviest: 1, "other": int64(i + 1)}, fingerprintSeries(), i)
+	}
+
+	// the engine without queries in the cycle has no heaviest fingerprints.
+	col.recordQueryFingerprints("acct", engines, till.Add(time.Hour), newFingerprintTracker())
+	require.Empty(t, fingerprintSeries())
+}
@@ -0,0 +1,426 @@
+package collector
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	api "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// defaultHistogramBounds are the bucket boundaries of the histograms, the same as the default ones of OpenTelemetry SDK.
+var defaultHistogramBounds = []float64{0, 5, 10, 25, 50, 75, 100, 250, 500, 750, 1000, 2500, 5000, 7500, 10000}
+
+// number is a type of the values recorded by the instruments.
+type number interface {
+	int64 | float64
+}
+
+// descriptor describes an instrument.
+type descriptor struct {
+	name        string
+	description string
+	unit        string
+}
+
+// Float64Gauge creates a new float64 gauge in the meter.
+func (m *meter) Float64Gauge(name string, options ...api.Float64GaugeOption) (*gauge[float64], error) {
+	cfg := api.NewFloat64GaugeConfig(options...)
+	g := newGauge[float64](descriptor{name: name, description: cfg.Description(), unit: cfg.Unit()})
+	return g, m.register(name, g)
+}
+
+// Int64Gauge creates a new int64 gauge in the meter.
+func (m *meter) Int64Gauge(name string, options ...api.Int64GaugeOption) (*gauge[int64], error) {
+	cfg := api.NewInt64GaugeConfig(options...)
+	g := newGauge[int64](descriptor{name: name, description: cfg.Description(), unit: cfg.Unit()})
+	return g, m.register(name, g)
+}
+
+// Float64Counter creates a new float64 monotonic sum in the meter.
+func (m *meter) Float64Counter(name string, options ...api.Float64CounterOption) (*sum[float64], error) {
+	cfg := api.NewFloat64CounterConfig(options...)
+	s := newSum[float64](descriptor{name: name, description: cfg.Description(), unit: cfg.Unit()})
+	return s, m.register(name, s)
+}
+
+// Int64Counter creates a new int64 monotonic sum in the meter.
+func (m *meter) Int64Counter(name string, options ...api.Int64CounterOption) (*sum[int64], error) {
+	cfg := api.NewInt64CounterConfig(options...)
+	s := newSum[int64](descriptor{name: name, description: cfg.Description(), unit: cfg.Unit()})
+	return s, m.register(name, s)
+}
+
+// Float64Histogram creates a new float64 explicit bucket histogram in the meter.
+func (m *meter) Float64Histogram(name string, options ...api.Float64HistogramOption) (*histogram, error) {
+	cfg := api.NewFloat64HistogramConfig(options...)
+
+	bounds := cfg.ExplicitBucketBoundaries()
+	if len(bounds) == 0 {
+		bounds = defaultHistogramBounds
+	}
+
+	h := newHistogram(descriptor{name: name, description: cfg.Description(), unit: cfg.Unit()}, bounds)
+	return h, m.register(name, h)
+}
+
+// gauge reports the values recorded for each attribute set since the last collection, or the latest recorded value,
+// if nothing was recorded since then.
+type gauge[N number] struct {
+	desc descriptor
+
+	mu     sync.Mutex
+	series map[attribute.Distinct]*gaugeSeries[N]
+}
+
+// gaugeSeries is the state of a single attribute set of a gauge.
+type gaugeSeries[N number] struct {
+	// latest is the latest recorded value.
+	latest metricdata.DataPoint[N]
+	// pending are the values recorded since the last collection, in the order of their time.
+	pending []metricdata.DataPoint[N]
+}
+
+func newGauge[N number](desc descriptor) *gauge[N] {
+	return &gauge[N]{
+		desc:   desc,
+		series: make(map[attribute.Distinct]*gaugeSeries[N]),
+	}
+}
+
+// Record records the value of the gauge at the time ts. Values older than the one already recorded are ignored,
+// and a value recorded at the same time replaces the previous one.
+func (g *gauge[N]) Record(ts time.Time, value N, attrs attribute.Set) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	point := metricdata.DataPoint[N]{
+		Attributes: attrs,
+		Time:       ts,
+		Value:      value,
+	}
+
+	key := attrs.Equivalent()
+	series, ok := g.series[key]
+	if !ok {
+		g.series[key] = &gaugeSeries[N]{latest: point, pending: []metricdata.DataPoint[N]{point}}
+		return
+	}
+
+	if ts.Before(series.latest.Time) {
+		return
+	}
+
+	if n := len(series.pending); n > 0 && series.pending[n-1].Time.Equal(ts) {
+		series.pending = series.pending[:n-1]
+	}
+
+	series.latest = point
+	series.pending = append(series.pending, point)
+}
+
+func (g *gauge[N]) collect(metric.TemporalitySelector) (metricdata.Metrics, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(g.series) == 0 {
+		return metricdata.Metrics{}, false
+	}
+
+	data := metricdata.Gauge[N]{DataPoints: make([]metricdata.DataPoint[N], 0, len(g.series))}
+	for _, series := range g.series {
+		if len(series.pending) == 0 {
+			data.DataPoints = append(data.DataPoints, series.latest)
+			continue
+		}
+
+		data.DataPoints = append(data.DataPoints, series.pending...)
+		series.pending = nil
+	}
+
+	return metricdata.Metrics{
+		Name:        g.desc.name,
+		Description: g.desc.description,
+		Unit:        g.desc.unit,
+		Data:        data,
+	}, true
+}
+
+// forget drops the series, which match provided function, right away, since their latest values are not current anymore.
+func (g *gauge[N]) forget(match func(attrs attribute.Set) bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for key, series := range g.series {
+		if match(series.latest.Attributes) {
+			delete(g.series, key)
+		}
+	}
+}
+
+// sumPoint is the aggregated state of a single attribute set of a sum.
+type sumPoint[N number] struct {
+	attrs     attribute.Set
+	startTime time.Time
+	time      time.Time
+	value     N
+	// updated tells whether anything was recorded since the last collection.
+	updated bool
+	// retired tells whether the point is dropped once it's collected.
+	retired bool
+}
+
+// sum reports the monotonic sum of the values recorded for each attribute set.
+type sum[N number] struct {
+	desc descriptor
+
+	mu     sync.Mutex
+	points map[attribute.Distinct]*sumPoint[N]
+}
+
+func newSum[N number](desc descriptor) *sum[N] {
+	return &sum[N]{
+		desc:   desc,
+		points: make(map[attribute.Distinct]*sumPoint[N]),
+	}
+}
+
+// Add adds the value, which happened at the time ts, to the sum. The sum starts at the time of its first value,
+// and is reported at the latest time recorded. Values recorded at an earlier time don't move either of them back,
+// so the callers should record the values at a time, which only moves forward, to report each value at a new time.
+func (s *sum[N]) Add(ts time.Time, value N, attrs attribute.Set) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := attrs.Equivalent()
+	point, ok := s.points[key]
+	if !ok {
+		point = &sumPoint[N]{attrs: attrs, startTime: ts, time: ts}
+		s.points[key] = point
+	}
+
+	point.time = later(point.time, ts)
+	point.value += value
+	point.updated = true
+	point.retired = false
+}
+
+func (s *sum[N]) collect(temporality metric.TemporalitySelector) (metricdata.Metrics, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := metricdata.Sum[N]{
+		Temporality: temporality(metric.InstrumentKindCounter),
+		IsMonotonic: true,
+	}
+
+	for key, point := range s.points {
+		if data.Temporality == metricdata.DeltaTemporality && !point.updated {
+			continue
+		}
+
+		data.DataPoints = append(data.DataPoints, metricdata.DataPoint[N]{
+			Attributes: point.attrs,
+			StartTime:  point.startTime,
+			Time:       point.time,
+			Value:      point.value,
+		})
+
+		if data.Temporality == metricdata.DeltaTemporality {
+			// the next delta starts where this one ended.
+			point.startTime = point.time
+			point.value = 0
+		}
+		point.updated = false
+
+		if point.retired {
+			delete(s.points, key)
+		}
+	}
+
+	if len(data.DataPoints) == 0 {
+		return metricdata.Metrics{}, false
+	}
+
+	return metricdata.Metrics{
+		Name:        s.desc.name,
+		Description: s.desc.description,
+		Unit:        s.desc.unit,
+		Data:        data,
+	}, true
+}
+
+// forget drops the points, which match provided function. The points with values recorded since the last collection
+// are dropped once they are collected, so that the values are not lost.
+func (s *sum[N]) forget(match func(attrs attribute.Set) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, point := range s.points {
+		if !match(point.attrs) {
+			continue
+		}
+
+		if point.updated {
+			point.retired = true
+			continue
+		}
+
+		delete(s.points, key)
+	}
+}
+
+// histogramPoint is the aggregated state of a single attribute set of a histogram.
+type histogramPoint struct {
+	attrs     attribute.Set
+	startTime time.Time
+	time      time.Time
+
+	bucketCounts []uint64
+	count        uint64
+	sum          float64
+	min          float64
+	max          float64
+
+	// updated tells whether anything was recorded since the last collection.
+	updated bool
+	// retired tells whether the point is dropped once it's collected.
+	retired bool
+}
+
+// histogram reports the distribution of the values recorded for each attribute set in explicit buckets.
+type histogram struct {
+	desc   descriptor
+	bounds []float64
+
+	mu     sync.Mutex
+	points map[attribute.Distinct]*histogramPoint
+}
+
+func newHistogram(desc descriptor, bounds []float64) *histogram {
+	return &histogram{
+		desc:   desc,
+		bounds: bounds,
+		points: make(map[attribute.Distinct]*histogramPoint),
+	}
+}
+
+// Record records the value, which happened at the time ts, in the histogram. Like a sum, the histogram starts
+// at the time of its first value, and is reported at the latest time recorded.
+func (h *histogram) Record(ts time.Time, value float64, attrs attribute.Set) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := attrs.Equivalent()
+	point, ok := h.points[key]
+	if !ok {
+		point = &histogramPoint{attrs: attrs, startTime: ts, time: ts}
+		h.points[key] = point
+	}
+
+	if point.count == 0 {
+		point.bucketCounts = make([]uint64, len(h.bounds)+1)
+		point.min, point.max = value, value
+	}
+
+	// the bucket i counts the values in (bounds[i-1], bounds[i]].
+	point.bucketCounts[sort.SearchFloat64s(h.bounds, value)]++
+	point.count++
+	point.sum += value
+	point.min = min(point.min, value)
+	point.max = max(point.max, value)
+
+	point.time = later(point.time, ts)
+	point.updated = true
+	point.retired = false
+}
+
+func (h *histogram) collect(temporality metric.TemporalitySelector) (metricdata.Metrics, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	data := metricdata.Histogram[float64]{
+		Temporality: temporality(metric.InstrumentKindHistogram),
+	}
+
+	for key, point := range h.points {
+		if data.Temporality == metricdata.DeltaTemporality && !point.updated {
+			continue
+		}
+
+		data.DataPoints = append(data.DataPoints, metricdata.HistogramDataPoint[float64]{
+			Attributes:   point.attrs,
+			StartTime:    point.startTime,
+			Time:         point.time,
+			Count:        point.count,
+			Bounds:       h.bounds,
+			BucketCounts: append([]uint64(nil), point.bucketCounts...),
+			Min:          metricdata.NewExtrema(point.min),
+			Max:          metricdata.NewExtrema(point.max),
+			Sum:          point.sum,
+		})
+
+		if data.Temporality == metricdata.DeltaTemporality {
+			// the next delta starts where this one ended.
+			point.startTime = point.time
+			point.bucketCounts = nil
+			point.count = 0
+			point.sum = 0
+		}
+		point.updated = false
+
+		if point.retired {
+			delete(h.points, key)
+		}
+	}
+
+	if len(data.DataPoints) == 0 {
+		return metricdata.Metrics{}, false
+	}
+
+	return metricdata.Metrics{
+		Name:        h.desc.name,
+		Description: h.desc.description,
+		Unit:        h.desc.unit,
+		Data:        data,
+	}, true
+}
+
+// forget drops the points, which match provided function. Like the points of a sum, the points with values
+// recorded since the last collection are dropped once they are collected.
+func (h *histogram) forget(match func(attrs attribute.Set) bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for key, point := range h.points {
+		if !match(point.attrs) {
+			continue
+		}
+
+		if point.updated {
+			point.retired = true
+			continue
+		}
+
+		delete(h.points, key)
+	}
+}
+
+// earlier returns the earlier of two timestamps.
+func earlier(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+// later returns the later of two timestamps.
+func later(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
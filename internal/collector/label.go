@@ -0,0 +1,133 @@
+package collector
+
+import (
+	"cmp"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// otherQueryLabel is the value of the query label attribute of the queries, which labels are not reported.
+const otherQueryLabel = "other"
+
+// QueryLabels defines how the query labels are reported as the attribute of the query history metrics.
+type QueryLabels struct {
+	// Enabled defines whether the query labels are reported at all.
+	Enabled bool
+	// Allow is the list of the labels, which are reported. Labels, which are not in the list and don't match
+	// the pattern either, are reported as other. All the labels are allowed, if neither is set.
+	Allow []string
+	// Pattern matches the labels, which are reported.
+	Pattern *regexp.Regexp
+	// Limit is the maximum number of distinct labels reported. The labels with the most queries in the previous
+	// cycle are reported, as well as the labels seen for the first time while the limit isn't reached yet.
+	// The other labels are reported as other. Zero means no limit.
+	Limit int
+}
+
+// queryLabeler tells the value of the query label attribute, keeping the number of distinct values bounded.
+type queryLabeler struct {
+	QueryLabels
+
+	mu sync.Mutex
+	// reported keeps the labels, which are reported within the cycle.
+	reported map[string]struct{}
+	// counts keeps the number of queries of each allowed label within the cycle, including the ones reported as other.
+	counts map[string]int64
+}
+
+func newQueryLabeler(labels QueryLabels) *queryLabeler {
+	return &queryLabeler{
+		QueryLabels: labels,
+		reported:    make(map[string]struct{}),
+		counts:      make(map[string]int64),
+	}
+}
+
+// label returns the value of the query label attribute of the query with provided label.
+func (l *queryLabeler) label(queryLabel string) string {
+	if !l.allowed(queryLabel) {
+		return otherQueryLabel
+	}
+
+	if l.Limit <= 0 {
+		return queryLabel
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.counts[queryLabel]++
+
+	if _, ok := l.reported[queryLabel]; ok {
+		return queryLabel
+	}
+
+	if len(l.reported) >= l.Limit {
+		return otherQueryLabel
+	}
+
+	l.reported[queryLabel] = struct{}{}
+	return queryLabel
+}
+
+// rotate starts a new cycle, in which the labels with the most queries in the finished cycle are reported. The labels,
+// which had no queries in the finished cycle, are not reported anymore, so that they make room for the new ones.
+// It returns the labels, which were reported in the finished cycle, but are not reported in the new one.
+func (l *queryLabeler) rotate() []string {
+	if l.Limit <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// the label breaks the ties, so that the result doesn't depend on the map order.
+	sorted := slices.SortedFunc(maps.Keys(l.counts), func(a, b string) int {
+		return cmp.Or(cmp.Compare(l.counts[b], l.counts[a]), strings.Compare(a, b))
+	})
+
+	reported := make(map[string]struct{}, l.Limit)
+	for _, queryLabel := range sorted[:min(l.Limit, len(sorted))] {
+		reported[queryLabel] = struct{}{}
+	}
+
+	var rotatedOut []string
+	for queryLabel := range l.reported {
+		if _, ok := reported[queryLabel]; !ok && queryLabel != otherQueryLabel {
+			rotatedOut = append(rotatedOut, queryLabel)
+		}
+	}
+
+	l.reported = reported
+	l.counts = make(map[string]int64)
+
+	return rotatedOut
+}
+
+// rotateQueryLabels starts a new cycle of the query labels, and stops reporting the series of the labels, which are
+// not reported in the new cycle, so that the number of exported series stays bounded by the limit.
+func (c *collector) rotateQueryLabels() {
+	rotatedOut := c.queryLabeler.rotate()
+	if len(rotatedOut) == 0 {
+		return
+	}
+
+	c.producer.Forget(func(attrs attribute.Set) bool {
+		queryLabel, ok := attrs.Value("firebolt.query.label")
+		return ok && slices.Contains(rotatedOut, queryLabel.AsString())
+	})
+}
+
+// allowed tells whether the label is either in the allow-list or matches the pattern.
+func (l *queryLabeler) allowed(queryLabel string) bool {
+	if len(l.Allow) == 0 && l.Pattern == nil {
+		return true
+	}
+
+	return slices.Contains(l.Allow, queryLabel) || (l.Pattern != nil && l.Pattern.MatchString(queryLabel))
+}
@@ -0,0 +1,189 @@
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/firebolt-db/otel-exporter/internal/fetcher"
+)
+
+func Test_queryLabeler_label(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		labels QueryLabels
+		input  []string
+		output []string
+	}{
+		{
+			name:   "all allowed",
+			labels: QueryLabels{Enabled: true},
+			input:  []string{"dbt", "looker", ""},
+			output: []string{"dbt", "looker", ""},
+		},
+		{
+			name:   "allow-list and pattern",
+			labels: QueryLabels{Enabled: true, Allow: []string{"looker"}, Pattern: regexp.MustCompile(`^dbt-`)},
+			input:  []string{"dbt-daily", "looker", "adhoc-1234", ""},
+			output: []string{"dbt-daily", "looker", "other", "other"},
+		},
+		{
+			name:   "limit",
+			labels: QueryLabels{Enabled: true, Limit: 2},
+			input:  []string{"dbt", "looker", "adhoc", "dbt", "looker"},
+			output: []string{"dbt", "looker", "other", "dbt", "looker"},
+		},
+		{
+			name:   "labels which are not allowed don't count towards the limit",
+			labels: QueryLabels{Enabled: true, Pattern: regexp.MustCompile(`^dbt-`), Limit: 1},
+			input:  []string{"adhoc", "dbt-daily", "dbt-hourly"},
+			output: []string{"other", "dbt-daily", "other"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			l := newQueryLabeler(tt.labels)
+
+			output := make([]string, 0, len(tt.input))
+			for _, label := range tt.input {
+				output = append(output, l.label(label))
+			}
+
+			require.Equal(t, tt.output, output)
+		})
+	}
+}
+
+func Test_queryLabeler_rotate(t *testing.T) {
+	t.Parallel()
+
+	l := newQueryLabeler(QueryLabels{Enabled: true, Limit: 2})
+
+	label := func(queryLabels ...string) []string {
+		output := make([]string, 0, len(queryLabels))
+		for _, queryLabel := range queryLabels {
+			output = append(output, l.label(queryLabel))
+		}
+		return output
+	}
+
+	// the first labels seen take the free slots
+	require.Equal(t, []string{"dbt", "looker", "other", "other", "other"}, label("dbt", "looker", "heavy", "heavy", "heavy"))
+
+	// the labels with the most queries in the previous cycle are reported
+	require.Equal(t, []string{"looker"}, l.rotate())
+	require.Equal(t, []string{"other", "heavy", "heavy"}, label("looker", "heavy", "heavy"))
+
+	// the label, which stopped appearing, makes room for the one reported as other in the previous cycle
+	require.Equal(t, []string{"dbt"}, l.rotate())
+	require.Equal(t, []string{"other", "looker", "heavy"}, label("dbt", "looker", "heavy"))
+}
+
+func Test_Collector_recordQueryHistoryPoint_queryLabels(t *testing.T) {
+	t.Parallel()
+
+	for _, enabled := range []bool{false, true} {
+		c, err := NewCollector(newFetcherMock(), []string{"acct"}, WithExporter(newExporterMock()),
+			WithQueryLabels(QueryLabels{Enabled: enabled, Allow: []string{"dbt"}}),
+		)
+		require.NoError(t, err)
+		t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+		col := c.(*collector)
+		now := time.Now().UTC()
+
+		for i, label := range []string{"dbt", "adhoc-1", "adhoc-2"} {
+			col.recordQueryHistoryPoint("acct", now, fetcher.QueryHistoryPoint{
+				EngineName:   "engine1",
+				QueryID:      sql.NullString{Valid: true, String: string(rune('a' + i))},
+				ScannedBytes: sql.NullInt64{Valid: true, Int64: 10},
+				QueryLabel:   sql.NullString{Valid: true, String: label},
+			})
+		}
+
+		sm, err := col.producer.Produce(context.Background())
+		require.NoError(t, err)
+		require.Len(t, sm, 1)
+
+		scannedBytes := make(map[string]int64)
+		for _, m := range sm[0].Metrics {
+			if m.Name != "firebolt.query.scanned.bytes" {
+				continue
+			}
+
+			for _, point := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				label, ok := point.Attributes.Value("firebolt.query.label")
+				require.Equal(t, enabled, ok)
+				scannedBytes[label.AsString()] += point.Value
+			}
+		}
+
+		if enabled {
+			require.Equal(t, map[string]int64{"dbt": 10, "other": 20}, scannedBytes)
+		} else {
+			require.Equal(t, map[string]int64{"": 30}, scannedBytes)
+		}
+	}
+}
+
+func Test_Collector_rotateQueryLabels(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewCollector(newFetcherMock(), []string{"acct"}, WithExporter(newExporterMock()),
+		WithQueryLabels(QueryLabels{Enabled: true, Limit: 1}),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+	col := c.(*collector)
+	now := time.Now().UTC()
+
+	queryID := 0
+	cycle := func(labels ...string) map[string]int64 {
+		for _, label := range labels {
+			queryID++
+			col.recordQueryHistoryPoint("acct", now, fetcher.QueryHistoryPoint{
+				EngineName:   "engine1",
+				QueryID:      sql.NullString{Valid: true, String: strconv.Itoa(queryID)},
+				ScannedBytes: sql.NullInt64{Valid: true, Int64: 10},
+				QueryLabel:   sql.NullString{Valid: true, String: label},
+			})
+		}
+
+		sm, err := col.producer.Produce(context.Background())
+		require.NoError(t, err)
+		col.rotateQueryLabels()
+
+		scannedBytes := make(map[string]int64)
+		for _, scope := range sm {
+			for _, m := range scope.Metrics {
+				if m.Name != "firebolt.query.scanned.bytes" {
+					continue
+				}
+
+				for _, point := range m.Data.(metricdata.Sum[int64]).DataPoints {
+					label, _ := point.Attributes.Value("firebolt.query.label")
+					scannedBytes[label.AsString()] = point.Value
+				}
+			}
+		}
+		return scannedBytes
+	}
+
+	require.Equal(t, map[string]int64{"dbt": 10, "other": 10}, cycle("dbt", "looker"))
+	// dbt is still reported in the cycle, in which it's rotated out
+	require.Equal(t, map[string]int64{"dbt": 10, "other": 30}, cycle("looker", "looker"))
+	// and not exported anymore once looker takes its slot
+	require.Equal(t, map[string]int64{"looker": 10, "other": 30}, cycle("looker"))
+}
@@ -3,8 +3,10 @@ package collector
 import (
 	"time"
 
+	sdklog "go.opentelemetry.io/otel/sdk/log"
 	"go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
@@ -14,9 +16,9 @@ const (
 
 var Version = "v0.0.0-dev"
 
-// newMeterProvider create a new opentelemetry meter provider, and instruments it with basic resource.
-func newMeterProvider(exporter metric.Exporter, interval time.Duration) (*metric.MeterProvider, error) {
-	res, err := resource.Merge(
+// newResource creates the resource, which the metrics, the logs and the spans of the exporter are reported by.
+func newResource() (*resource.Resource, error) {
+	return resource.Merge(
 		resource.Default(),
 		resource.NewWithAttributes(
 			semconv.SchemaURL,
@@ -24,6 +26,12 @@ func newMeterProvider(exporter metric.Exporter, interval time.Duration) (*metric
 			semconv.ServiceVersion(Version),
 		),
 	)
+}
+
+// newMeterProvider create a new opentelemetry meter provider, and instruments it with basic resource.
+// The data points of the producer are exported along with the ones of the meter provider.
+func newMeterProvider(exporter metric.Exporter, interval time.Duration, producer metric.Producer) (*metric.MeterProvider, error) {
+	res, err := newResource()
 	if err != nil {
 		return nil, err
 	}
@@ -33,9 +41,42 @@ func newMeterProvider(exporter metric.Exporter, interval time.Duration) (*metric
 		metric.WithReader(
 			metric.NewPeriodicReader(exporter,
 				metric.WithInterval(interval),
+				metric.WithProducer(producer),
 			),
 		),
 	)
 
 	return mp, nil
 }
+
+// newLoggerProvider creates a new opentelemetry logger provider with the same resource as the meter provider.
+// The log records are exported in batches.
+func newLoggerProvider(exporter sdklog.Exporter) (*sdklog.LoggerProvider, error) {
+	res, err := newResource()
+	if err != nil {
+		return nil, err
+	}
+
+	lp := sdklog.NewLoggerProvider(
+		sdklog.WithResource(res),
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter)),
+	)
+
+	return lp, nil
+}
+
+// newTracerProvider creates a new opentelemetry tracer provider with the same resource as the meter provider.
+// The spans are exported in batches.
+func newTracerProvider(exporter sdktrace.SpanExporter) (*sdktrace.TracerProvider, error) {
+	res, err := newResource()
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithResource(res),
+		sdktrace.WithBatcher(exporter),
+	)
+
+	return tp, nil
+}
@@ -1,48 +1,103 @@
 package collector
 
-import "go.opentelemetry.io/otel/metric"
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/firebolt-db/otel-exporter/internal/state"
+)
 
 // runtimeMetrics specifies a set of engine runtime metrics.
 type runtimeMetrics struct {
-	cpuUtilization    metric.Float64Gauge
-	memoryUtilization metric.Float64Gauge
-	diskUtilization   metric.Float64Gauge
-	cacheUtilization  metric.Float64Gauge
+	cpuUtilization    *gauge[float64]
+	memoryUtilization *gauge[float64]
+	diskUtilization   *gauge[float64]
+	cacheUtilization  *gauge[float64]
 	// diskSpilled is a gauge (not a counter) because engine_metrics_history.spilled_bytes
 	// reports the current bytes occupying disk at snapshot time, and naturally goes back to 0.
-	diskSpilled metric.Int64Gauge
-	runningQueries    metric.Int64Gauge
-	suspendedQueries  metric.Int64Gauge
+	diskSpilled      *gauge[int64]
+	runningQueries   *gauge[int64]
+	suspendedQueries *gauge[int64]
+
+	// cpuUtilizationWindow, memoryUtilizationWindow and diskUtilizationWindow aggregate all the samples within
+	// the collection window, so that short bursts between the collections are visible.
+	cpuUtilizationWindow    windowGauges
+	memoryUtilizationWindow windowGauges
+	diskUtilizationWindow   windowGauges
+}
+
+// windowGauges specifies a set of gauges, which report the aggregates of a runtime metric within the collection window.
+type windowGauges struct {
+	min *gauge[float64]
+	max *gauge[float64]
+	avg *gauge[float64]
 }
 
 // queryHistoryMetrics specifies a set of engine query history metrics.
 type queryHistoryMetrics struct {
-	queryDuration metric.Float64Histogram
+	queryDuration *histogram
+	// queryCount and queryErrors count the queries, so that the failure rate doesn't have to be derived
+	// from the count of the duration histogram.
+	queryCount  *sum[int64]
+	queryErrors *sum[int64]
 
-	scannedRows  metric.Int64Counter
-	scannedBytes metric.Int64Counter
+	scannedRows  *sum[int64]
+	scannedBytes *sum[int64]
 
-	insertedRows  metric.Int64Counter
-	insertedBytes metric.Int64Counter
+	insertedRows  *sum[int64]
+	insertedBytes *sum[int64]
 
-	returnedRows  metric.Int64Counter
-	returnedBytes metric.Int64Counter
+	returnedRows  *sum[int64]
+	returnedBytes *sum[int64]
 	// spilledBytes is a counter because engine_query_history.spilled_bytes reports the
 	// cumulative total bytes written to disk by the spiller for each completed query.
-	spilledBytes metric.Int64Counter
+	spilledBytes *sum[int64]
+
+	queueTime            *sum[float64]
+	queryGatewayDuration *histogram
 
-	queueTime            metric.Float64Counter
-	queryGatewayDuration metric.Float64Histogram
+	// exporterQueries, exporterQueryDuration and exporterScannedBytes report the load, which the queries of
+	// the exporter itself put on the engines. These queries are not reported in the other query history metrics.
+	exporterQueries       *sum[int64]
+	exporterQueryDuration *sum[float64]
+	exporterScannedBytes  *sum[int64]
+
+	// fingerprintQueries, fingerprintDuration and fingerprintScannedBytes report the load of the heaviest query
+	// fingerprints of each engine.
+	fingerprintQueries      *sum[int64]
+	fingerprintDuration     *sum[float64]
+	fingerprintScannedBytes *sum[int64]
+
+	// slowQueries counts the queries, which exceed any of their slow query thresholds.
+	slowQueries *sum[int64]
 }
 
 // exporterMetrics specifies a set of supplementary metrics of otel-exporter.
 type exporterMetrics struct {
 	duration metric.Float64Counter
+	// engineTimeouts counts the engines, which data points were not fetched in time.
+	engineTimeouts metric.Int64Counter
+	// accountDuration is the duration of collecting the metrics of a single account within a cycle.
+	accountDuration metric.Float64Histogram
+	// overrunCycles counts the cycles, which ran past the boundary of the next one.
+	overrunCycles metric.Int64Counter
+	// skippedCycles counts the windows, which were not collected because of the overrun cycles.
+	skippedCycles metric.Int64Counter
+	// watermarkLag is observed from the watermarks of running engines on every export.
+	watermarkLag metric.Float64ObservableGauge
+	// dataFreshness is observed from the newest data points of running engines on every export.
+	dataFreshness metric.Float64ObservableGauge
+	// clockSkew is observed from the clock of the collector on every export, once it's synced with Firebolt.
+	clockSkew metric.Float64ObservableGauge
 }
 
 // setupRuntimeMetrics prepares engine runtime metrics with basic attributes and unit.
+// The metrics are reported by the producer, so that data points keep the timestamp they were recorded with.
 func (c *collector) setupRuntimeMetrics() error {
-	meter := c.meterProvider.Meter("firebolt.engine.runtime")
+	meter := c.producer.Meter("firebolt.engine.runtime")
 
 	var err error
 	rm := &runtimeMetrics{}
@@ -110,13 +165,68 @@ func (c *collector) setupRuntimeMetrics() error {
 		return err
 	}
 
+	rm.cpuUtilizationWindow, err = newWindowGauges(meter,
+		"firebolt.engine.cpu.utilization", "CPU utilization within the collection window (percentage)", "percent",
+	)
+	if err != nil {
+		return err
+	}
+
+	rm.memoryUtilizationWindow, err = newWindowGauges(meter,
+		"firebolt.engine.memory.utilization", "memory used within the collection window (percentage)", "percent",
+	)
+	if err != nil {
+		return err
+	}
+
+	rm.diskUtilizationWindow, err = newWindowGauges(meter,
+		"firebolt.engine.disk.utilization", "used disk space within the collection window (percentage)", "percent",
+	)
+	if err != nil {
+		return err
+	}
+
 	c.runtimeMetrics = rm
 	return nil
 }
 
+// newWindowGauges prepares the minimum, maximum and average gauges of a runtime metric, named with the corresponding
+// suffix.
+func newWindowGauges(meter *meter, name, description, unit string) (windowGauges, error) {
+	var err error
+	wg := windowGauges{}
+
+	wg.min, err = meter.Float64Gauge(name+".min",
+		metric.WithDescription("Minimal "+description),
+		metric.WithUnit(unit),
+	)
+	if err != nil {
+		return wg, err
+	}
+
+	wg.max, err = meter.Float64Gauge(name+".max",
+		metric.WithDescription("Maximal "+description),
+		metric.WithUnit(unit),
+	)
+	if err != nil {
+		return wg, err
+	}
+
+	wg.avg, err = meter.Float64Gauge(name+".avg",
+		metric.WithDescription("Average "+description),
+		metric.WithUnit(unit),
+	)
+	if err != nil {
+		return wg, err
+	}
+
+	return wg, nil
+}
+
 // setupQueryHistoryMetrics prepares engine query history metrics with basic attributes and unit.
+// The metrics are reported by the producer, so that data points keep the timestamp they were recorded with.
 func (c *collector) setupQueryHistoryMetrics() error {
-	meter := c.meterProvider.Meter("firebolt.engine.query_history")
+	meter := c.producer.Meter("firebolt.engine.query_history")
 
 	var err error
 	qhm := &queryHistoryMetrics{}
@@ -130,6 +240,24 @@ func (c *collector) setupQueryHistoryMetrics() error {
 		return err
 	}
 
+	qhm.queryCount, err = meter.Int64Counter(
+		"firebolt.query.count",
+		metric.WithDescription("The total number of queries"),
+		metric.WithUnit("{query}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	qhm.queryErrors, err = meter.Int64Counter(
+		"firebolt.query.errors",
+		metric.WithDescription("The total number of queries, which failed"),
+		metric.WithUnit("{query}"),
+	)
+	if err != nil {
+		return err
+	}
+
 	qhm.scannedRows, err = meter.Int64Counter(
 		"firebolt.query.scanned.rows",
 		metric.WithDescription("The total number of rows scanned"),
@@ -211,6 +339,69 @@ func (c *collector) setupQueryHistoryMetrics() error {
 		return err
 	}
 
+	qhm.exporterQueries, err = meter.Int64Counter(
+		"firebolt.exporter.queries",
+		metric.WithDescription("The total number of queries executed by the exporter"),
+		metric.WithUnit("{query}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	qhm.exporterQueryDuration, err = meter.Float64Counter(
+		"firebolt.exporter.query.duration",
+		metric.WithDescription("The total duration of queries executed by the exporter"),
+		metric.WithUnit("second"),
+	)
+	if err != nil {
+		return err
+	}
+
+	qhm.exporterScannedBytes, err = meter.Int64Counter(
+		"firebolt.exporter.scanned.bytes",
+		metric.WithDescription("The total number of bytes scanned by queries executed by the exporter"),
+		metric.WithUnit("bytes"),
+	)
+	if err != nil {
+		return err
+	}
+
+	qhm.fingerprintQueries, err = meter.Int64Counter(
+		"firebolt.query.fingerprint.count",
+		metric.WithDescription("The total number of queries of the query fingerprint"),
+		metric.WithUnit("{query}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	qhm.fingerprintDuration, err = meter.Float64Counter(
+		"firebolt.query.fingerprint.duration",
+		metric.WithDescription("The total duration of queries of the query fingerprint"),
+		metric.WithUnit("second"),
+	)
+	if err != nil {
+		return err
+	}
+
+	qhm.fingerprintScannedBytes, err = meter.Int64Counter(
+		"firebolt.query.fingerprint.scanned.bytes",
+		metric.WithDescription("The total number of bytes scanned by queries of the query fingerprint"),
+		metric.WithUnit("bytes"),
+	)
+	if err != nil {
+		return err
+	}
+
+	qhm.slowQueries, err = meter.Int64Counter(
+		"firebolt.query.slow.count",
+		metric.WithDescription("The number of queries, which exceeded any of their slow query thresholds"),
+		metric.WithUnit("{query}"),
+	)
+	if err != nil {
+		return err
+	}
+
 	c.queryHistoryMetrics = qhm
 	return nil
 }
@@ -231,6 +422,123 @@ func (c *collector) setupExporterMetrics() error {
 		return err
 	}
 
+	em.engineTimeouts, err = meter.Int64Counter(
+		"firebolt.exporter.engine.timeouts",
+		metric.WithDescription("Number of times the metrics of the engine were not fetched before the timeout"),
+		metric.WithUnit("{timeout}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	em.accountDuration, err = meter.Float64Histogram(
+		"firebolt.exporter.account.duration",
+		metric.WithDescription("Duration of collecting the metrics of the account within a collection routine"),
+		metric.WithUnit("second"),
+		metric.WithExplicitBucketBoundaries(0.5, 1, 2.5, 5, 10, 15, 30, 60, 120, 300),
+	)
+	if err != nil {
+		return err
+	}
+
+	em.overrunCycles, err = meter.Int64Counter(
+		"firebolt.exporter.cycles.overrun",
+		metric.WithDescription("Number of collection routines, which ran past the start of the next one"),
+		metric.WithUnit("{cycle}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	em.skippedCycles, err = meter.Int64Counter(
+		"firebolt.exporter.cycles.skipped",
+		metric.WithDescription("Number of collection windows, which were skipped because of overrun collection routines"),
+		metric.WithUnit("{cycle}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	em.watermarkLag, err = meter.Float64ObservableGauge(
+		"firebolt.exporter.watermark.lag",
+		metric.WithDescription("Time between the end of the last fully collected window of the engine and now"),
+		metric.WithUnit("second"),
+		metric.WithFloat64Callback(c.observeWatermarkLag),
+	)
+	if err != nil {
+		return err
+	}
+
+	em.dataFreshness, err = meter.Float64ObservableGauge(
+		"firebolt.exporter.data.freshness",
+		metric.WithDescription("Time between the newest data point collected of the engine and now"),
+		metric.WithUnit("second"),
+		metric.WithFloat64Callback(c.observeDataFreshness),
+	)
+	if err != nil {
+		return err
+	}
+
+	em.clockSkew, err = meter.Float64ObservableGauge(
+		"firebolt.exporter.clock.skew",
+		metric.WithDescription("Difference between the time of Firebolt and the time of the local clock"),
+		metric.WithUnit("second"),
+		metric.WithFloat64Callback(c.observeClockSkew),
+	)
+	if err != nil {
+		return err
+	}
+
 	c.exporterMetrics = em
 	return nil
 }
+
+// observeWatermarkLag reports how far behind the wall-clock time the watermarks of the running engines are.
+func (c *collector) observeWatermarkLag(_ context.Context, o metric.Float64Observer) error {
+	c.observeEngineLag(o, (*progress).watermark)
+	return nil
+}
+
+// observeDataFreshness reports how far behind the wall-clock time the newest data points of the running engines are.
+// It tells how long it takes for the data to appear in information_schema, which the offset of a source should cover.
+func (c *collector) observeDataFreshness(_ context.Context, o metric.Float64Observer) error {
+	c.observeEngineLag(o, (*progress).newest)
+	return nil
+}
+
+// observeEngineLag reports how far behind the wall-clock time the time of each running engine and source is.
+// The time is read from the progress of the source by provided accessor, engines without one are skipped.
+func (c *collector) observeEngineLag(o metric.Float64Observer, timeOf func(*progress, state.Key) (time.Time, bool)) {
+	c.enginesMu.Lock()
+	defer c.enginesMu.Unlock()
+
+	now := c.clock.now()
+	sources := c.sources()
+
+	for accountName, engines := range c.engines {
+		for _, engine := range engines {
+			for _, source := range sources {
+				t, ok := timeOf(source.progress, state.Key{Account: accountName, Engine: engine.Name})
+				if !ok {
+					continue
+				}
+
+				o.Observe(now.Sub(t).Seconds(), metric.WithAttributes(
+					attribute.Key("firebolt.account.name").String(accountName),
+					attribute.Key("firebolt.engine.name").String(engine.Name),
+					attribute.Key("firebolt.exporter.source").String(source.name),
+				))
+			}
+		}
+	}
+}
+
+// observeClockSkew reports how far ahead of the local clock the time of Firebolt is. Nothing is reported,
+// unless the clock was synced with Firebolt.
+func (c *collector) observeClockSkew(_ context.Context, o metric.Float64Observer) error {
+	if skew, ok := c.clock.observedSkew(); ok {
+		o.Observe(skew.Seconds())
+	}
+
+	return nil
+}
@@ -3,7 +3,12 @@ package collector
 import (
 	"time"
 
+	sdklog "go.opentelemetry.io/otel/sdk/log"
 	"go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/firebolt-db/otel-exporter/internal/errorclass"
+	"github.com/firebolt-db/otel-exporter/internal/state"
 )
 
 type Option interface {
@@ -31,3 +36,150 @@ func WithExportInterval(interval time.Duration) Option {
 		return collector
 	})
 }
+
+// WithQueryHistoryLookback applies provided query history lookback window to the Collector
+func WithQueryHistoryLookback(lookback time.Duration) Option {
+	return optionFunc(func(collector *collector) *collector {
+		collector.queryHistoryLookback = lookback
+		return collector
+	})
+}
+
+// WithStateStore applies provided state store to the Collector, which keeps the query history progress between runs
+func WithStateStore(s state.Store) Option {
+	return optionFunc(func(collector *collector) *collector {
+		collector.stateStore = s
+		return collector
+	})
+}
+
+// WithMaxCatchUp applies provided maximal catch-up period to the Collector
+func WithMaxCatchUp(maxCatchUp time.Duration) Option {
+	return optionFunc(func(collector *collector) *collector {
+		collector.maxCatchUp = maxCatchUp
+		return collector
+	})
+}
+
+// WithRuntimeWindowAggregates makes the Collector report minimum, maximum and average of the runtime samples
+// within the collection window
+func WithRuntimeWindowAggregates(enabled bool) Option {
+	return optionFunc(func(collector *collector) *collector {
+		collector.runtimeWindowAggregates = enabled
+		return collector
+	})
+}
+
+// WithExporterQueries makes the Collector include the queries of the exporter itself in the query history metrics
+func WithExporterQueries(include bool) Option {
+	return optionFunc(func(collector *collector) *collector {
+		collector.includeExporterQueries = include
+		return collector
+	})
+}
+
+// WithCycleTimeout limits how long a single collection cycle of the Collector runs
+func WithCycleTimeout(timeout time.Duration) Option {
+	return optionFunc(func(collector *collector) *collector {
+		collector.cycleTimeout = timeout
+		return collector
+	})
+}
+
+// WithAccountConcurrency applies provided maximal number of accounts, which the Collector collects at once
+func WithAccountConcurrency(concurrency int) Option {
+	return optionFunc(func(collector *collector) *collector {
+		collector.accountConcurrency = concurrency
+		return collector
+	})
+}
+
+// WithOverrunPolicy applies provided policy to the Collector, which defines how the cycles running past the boundary
+// of the next one are handled
+func WithOverrunPolicy(policy OverrunPolicy) Option {
+	return optionFunc(func(collector *collector) *collector {
+		collector.overrunPolicy = policy
+		return collector
+	})
+}
+
+// WithRuntimeSchedule applies provided schedule of the engine runtime metrics to the Collector
+func WithRuntimeSchedule(schedule Schedule) Option {
+	return optionFunc(func(collector *collector) *collector {
+		collector.runtimeSchedule = schedule
+		return collector
+	})
+}
+
+// WithQueryHistorySchedule applies provided schedule of the query history metrics to the Collector
+func WithQueryHistorySchedule(schedule Schedule) Option {
+	return optionFunc(func(collector *collector) *collector {
+		collector.queryHistorySchedule = schedule
+		return collector
+	})
+}
+
+// WithServerTime makes the Collector base the collection windows on the time of Firebolt rather than the local clock
+func WithServerTime(enabled bool) Option {
+	return optionFunc(func(collector *collector) *collector {
+		collector.serverTime = enabled
+		return collector
+	})
+}
+
+// WithErrorClassifier applies provided classifier of the error messages of the failed queries to the Collector
+func WithErrorClassifier(classifier *errorclass.Classifier) Option {
+	return optionFunc(func(collector *collector) *collector {
+		collector.errorClassifier = classifier
+		return collector
+	})
+}
+
+// WithQueryLabels applies provided reporting of the query labels to the Collector
+func WithQueryLabels(labels QueryLabels) Option {
+	return optionFunc(func(collector *collector) *collector {
+		collector.queryLabeler = newQueryLabeler(labels)
+		return collector
+	})
+}
+
+// WithQueryFingerprintsTopK applies provided number of the heaviest query fingerprints of each engine, which are
+// reported in each cycle, to the Collector
+func WithQueryFingerprintsTopK(k int) Option {
+	return optionFunc(func(collector *collector) *collector {
+		collector.queryFingerprintsTopK = k
+		return collector
+	})
+}
+
+// WithQuerySpans applies provided exporter of the query spans to the Collector
+func WithQuerySpans(exporter sdktrace.SpanExporter) Option {
+	return optionFunc(func(collector *collector) *collector {
+		collector.spanExporter = exporter
+		return collector
+	})
+}
+
+// WithLogExporter applies provided exporter of the log records to the Collector
+func WithLogExporter(exporter sdklog.Exporter) Option {
+	return optionFunc(func(collector *collector) *collector {
+		collector.logExporter = exporter
+		return collector
+	})
+}
+
+// WithSlowQueries applies provided reporting of the slow queries to the Collector
+func WithSlowQueries(slowQueries SlowQueries) Option {
+	return optionFunc(func(collector *collector) *collector {
+		collector.slowQueries = slowQueries
+		return collector
+	})
+}
+
+// WithQueryLogs applies provided emission of the queries as log records to the Collector
+func WithQueryLogs(logs QueryLogs) Option {
+	return optionFunc(func(collector *collector) *collector {
+		collector.queryLogs = logs
+		return collector
+	})
+}
@@ -0,0 +1,116 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// instrument is an instrument of the producer, which aggregates the recorded data points.
+type instrument interface {
+	// collect returns the aggregated data points of the instrument, and false if there are none to report.
+	collect(temporality metric.TemporalitySelector) (metricdata.Metrics, bool)
+	// forget drops the aggregated data points of the attribute sets, which match provided function.
+	forget(match func(attrs attribute.Set) bool)
+}
+
+// producer is a [metric.Producer], which reports the data points of the instruments created by its meters.
+// Unlike the synchronous instruments of OpenTelemetry SDK, these instruments record data points with an explicit
+// timestamp, so the points are exported with the time they describe rather than the time they were collected at.
+type producer struct {
+	temporality metric.TemporalitySelector
+
+	mu     sync.Mutex
+	meters []*meter
+}
+
+var _ metric.Producer = (*producer)(nil)
+
+// newProducer creates a new producer, which aggregates the counters and histograms with the temporality
+// expected by the exporter.
+func newProducer(temporality metric.TemporalitySelector) *producer {
+	return &producer{
+		temporality: temporality,
+	}
+}
+
+// Meter returns a new meter, which reports its instruments under the instrumentation scope with provided name.
+func (p *producer) Meter(name string) *meter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	m := &meter{
+		producer: p,
+		scope:    instrumentation.Scope{Name: name},
+		names:    make(map[string]struct{}),
+	}
+	p.meters = append(p.meters, m)
+
+	return m
+}
+
+// Produce returns the data points of all the instruments, which have any to report.
+func (p *producer) Produce(context.Context) ([]metricdata.ScopeMetrics, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var scopeMetrics []metricdata.ScopeMetrics
+	for _, m := range p.meters {
+		sm := metricdata.ScopeMetrics{Scope: m.scope}
+		for _, inst := range m.instruments {
+			if data, ok := inst.collect(p.temporality); ok {
+				sm.Metrics = append(sm.Metrics, data)
+			}
+		}
+
+		if len(sm.Metrics) > 0 {
+			scopeMetrics = append(scopeMetrics, sm)
+		}
+	}
+
+	return scopeMetrics, nil
+}
+
+// Forget drops the data points of all the instruments, which attribute sets match provided function,
+// so that they are not reported anymore. The values of counters and histograms, which were not reported yet,
+// are reported once more before they are dropped.
+func (p *producer) Forget(match func(attrs attribute.Set) bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, m := range p.meters {
+		for _, inst := range m.instruments {
+			inst.forget(match)
+		}
+	}
+}
+
+// meter creates the instruments of a single instrumentation scope.
+type meter struct {
+	producer *producer
+	scope    instrumentation.Scope
+
+	// instruments and names are guarded by the mutex of the producer.
+	instruments []instrument
+	names       map[string]struct{}
+}
+
+// register adds the instrument to the meter, unless there's already an instrument with the same name.
+func (m *meter) register(name string, inst instrument) error {
+	m.producer.mu.Lock()
+	defer m.producer.mu.Unlock()
+
+	if _, ok := m.names[name]; ok {
+		return fmt.Errorf("instrument %s is already registered in meter %s", name, m.scope.Name)
+	}
+
+	m.names[name] = struct{}{}
+	m.instruments = append(m.instruments, inst)
+
+	return nil
+}
@@ -0,0 +1,239 @@
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	api "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func Test_producer_Produce(t *testing.T) {
+	t.Parallel()
+
+	p := newProducer(metric.DefaultTemporalitySelector)
+	m := p.Meter("test")
+
+	g, err := m.Float64Gauge("gauge", api.WithDescription("gauge description"), api.WithUnit("percent"))
+	require.NoError(t, err)
+	s, err := m.Int64Counter("sum", api.WithUnit("bytes"))
+	require.NoError(t, err)
+	h, err := m.Float64Histogram("histogram", api.WithExplicitBucketBoundaries(1, 10))
+	require.NoError(t, err)
+
+	_, err = m.Int64Gauge("gauge")
+	require.ErrorContains(t, err, "instrument gauge is already registered in meter test")
+
+	// nothing recorded yet
+	sm, err := p.Produce(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, sm)
+
+	attrs := attribute.NewSet(attribute.String("engine", "e1"))
+	t1 := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Minute)
+
+	g.Record(t1, 10, attrs)
+	g.Record(t2, 20, attrs)
+	g.Record(t1, 30, attrs) // older value is ignored
+	s.Add(t1, 5, attrs)
+	s.Add(t2, 7, attrs)
+	h.Record(t1, 0.5, attrs)
+	h.Record(t2, 5, attrs)
+	h.Record(t2, 50, attrs)
+
+	sm, err = p.Produce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, sm, 1)
+	require.Equal(t, "test", sm[0].Scope.Name)
+	require.Equal(t, []metricdata.Metrics{
+		{
+			Name:        "gauge",
+			Description: "gauge description",
+			Unit:        "percent",
+			Data: metricdata.Gauge[float64]{DataPoints: []metricdata.DataPoint[float64]{
+				{Attributes: attrs, Time: t1, Value: 10},
+				{Attributes: attrs, Time: t2, Value: 20},
+			}},
+		},
+		{
+			Name: "sum",
+			Unit: "bytes",
+			Data: metricdata.Sum[int64]{
+				Temporality: metricdata.CumulativeTemporality,
+				IsMonotonic: true,
+				DataPoints: []metricdata.DataPoint[int64]{
+					{Attributes: attrs, StartTime: t1, Time: t2, Value: 12},
+				},
+			},
+		},
+		{
+			Name: "histogram",
+			Data: metricdata.Histogram[float64]{
+				Temporality: metricdata.CumulativeTemporality,
+				DataPoints: []metricdata.HistogramDataPoint[float64]{
+					{
+						Attributes:   attrs,
+						StartTime:    t1,
+						Time:         t2,
+						Count:        3,
+						Bounds:       []float64{1, 10},
+						BucketCounts: []uint64{1, 1, 1},
+						Min:          metricdata.NewExtrema(0.5),
+						Max:          metricdata.NewExtrema(50.0),
+						Sum:          55.5,
+					},
+				},
+			},
+		},
+	}, sm[0].Metrics)
+
+	// cumulative data points and the latest value of the gauge are reported again, even if nothing was recorded.
+	again, err := p.Produce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, metricdata.Gauge[float64]{DataPoints: []metricdata.DataPoint[float64]{
+		{Attributes: attrs, Time: t2, Value: 20},
+	}}, again[0].Metrics[0].Data)
+	require.Equal(t, sm[0].Metrics[1:], again[0].Metrics[1:])
+}
+
+func Test_producer_Produce_delta(t *testing.T) {
+	t.Parallel()
+
+	p := newProducer(func(metric.InstrumentKind) metricdata.Temporality {
+		return metricdata.DeltaTemporality
+	})
+	m := p.Meter("test")
+
+	s, err := m.Float64Counter("sum")
+	require.NoError(t, err)
+	h, err := m.Float64Histogram("histogram")
+	require.NoError(t, err)
+
+	attrs := attribute.NewSet(attribute.String("engine", "e1"))
+	t1 := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Minute)
+	t3 := t2.Add(time.Minute)
+
+	s.Add(t1, 1, attrs)
+	s.Add(t2, 2, attrs)
+	h.Record(t2, 3, attrs)
+
+	sm, err := p.Produce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, sm, 1)
+	require.Len(t, sm[0].Metrics, 2)
+	require.Equal(t, []metricdata.DataPoint[float64]{
+		{Attributes: attrs, StartTime: t1, Time: t2, Value: 3},
+	}, sm[0].Metrics[0].Data.(metricdata.Sum[float64]).DataPoints)
+	require.Equal(t, uint64(1), sm[0].Metrics[1].Data.(metricdata.Histogram[float64]).DataPoints[0].Count)
+
+	// nothing recorded since the last collection
+	sm, err = p.Produce(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, sm)
+
+	// the next delta starts where the previous one ended
+	s.Add(t3, 4, attrs)
+	sm, err = p.Produce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, sm, 1)
+	require.Equal(t, []metricdata.Metrics{
+		{
+			Name: "sum",
+			Data: metricdata.Sum[float64]{
+				Temporality: metricdata.DeltaTemporality,
+				IsMonotonic: true,
+				DataPoints: []metricdata.DataPoint[float64]{
+					{Attributes: attrs, StartTime: t2, Time: t3, Value: 4},
+				},
+			},
+		},
+	}, sm[0].Metrics)
+}
+
+func Test_producer_Produce_latePoints(t *testing.T) {
+	t.Parallel()
+
+	p := newProducer(metric.DefaultTemporalitySelector)
+	m := p.Meter("test")
+
+	s, err := m.Int64Counter("sum")
+	require.NoError(t, err)
+	h, err := m.Float64Histogram("histogram")
+	require.NoError(t, err)
+
+	attrs := attribute.NewSet(attribute.String("engine", "e1"))
+	t1 := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Minute)
+
+	s.Add(t2, 1, attrs)
+	h.Record(t2, 1, attrs)
+
+	_, err = p.Produce(context.Background())
+	require.NoError(t, err)
+
+	// values recorded at an earlier time don't move the start of the series back, which would be read as a reset
+	s.Add(t1, 2, attrs)
+	h.Record(t1, 2, attrs)
+
+	sm, err := p.Produce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, sm, 1)
+	require.Equal(t, []metricdata.DataPoint[int64]{
+		{Attributes: attrs, StartTime: t2, Time: t2, Value: 3},
+	}, sm[0].Metrics[0].Data.(metricdata.Sum[int64]).DataPoints)
+
+	point := sm[0].Metrics[1].Data.(metricdata.Histogram[float64]).DataPoints[0]
+	require.Equal(t, t2, point.StartTime)
+	require.Equal(t, t2, point.Time)
+	require.Equal(t, uint64(2), point.Count)
+}
+
+func Test_producer_Forget(t *testing.T) {
+	t.Parallel()
+
+	p := newProducer(metric.DefaultTemporalitySelector)
+	m := p.Meter("test")
+
+	g, err := m.Float64Gauge("gauge")
+	require.NoError(t, err)
+	s, err := m.Int64Counter("sum")
+	require.NoError(t, err)
+	h, err := m.Float64Histogram("histogram")
+	require.NoError(t, err)
+
+	exported := attribute.NewSet(attribute.String("engine", "e1"))
+	pending := attribute.NewSet(attribute.String("engine", "e2"))
+	ts := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	s.Add(ts, 1, exported)
+	h.Record(ts, 1, exported)
+
+	_, err = p.Produce(context.Background())
+	require.NoError(t, err)
+
+	g.Record(ts, 1, pending)
+	s.Add(ts, 2, pending)
+	h.Record(ts, 2, pending)
+
+	p.Forget(func(attribute.Set) bool { return true })
+
+	// the gauge is dropped right away, the values of the counter and the histogram are reported once more
+	sm, err := p.Produce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, sm, 1)
+	require.Len(t, sm[0].Metrics, 2)
+	require.Equal(t, []metricdata.DataPoint[int64]{
+		{Attributes: pending, StartTime: ts, Time: ts, Value: 2},
+	}, sm[0].Metrics[0].Data.(metricdata.Sum[int64]).DataPoints)
+	require.Len(t, sm[0].Metrics[1].Data.(metricdata.Histogram[float64]).DataPoints, 1)
+
+	sm, err = p.Produce(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, sm)
+}
@@ -0,0 +1,223 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/firebolt-db/otel-exporter/internal/fetcher"
+	"github.com/firebolt-db/otel-exporter/internal/state"
+)
+
+// engineProgress is the collection progress of a single engine.
+type engineProgress struct {
+	// watermark is the end of the last window, which data was fully delivered.
+	watermark time.Time
+	// reported maps query_id of the queries, which were already reported within the lookback window, to their
+	// submitted_time, so that a query read again within the lookback window is reported only once.
+	reported map[string]time.Time
+	// newest is the time of the newest data point seen, which tells how fresh the data of the engine is.
+	newest time.Time
+}
+
+// progress tracks the collection progress of each engine. The watermark of an engine only advances once the data
+// of its window is fully delivered, so that a failed window is collected again on the next cycle.
+type progress struct {
+	mu      sync.Mutex
+	engines map[state.Key]*engineProgress
+	// skipBefore is the end of the latest window skipped by the overrun policy. Engines don't resume
+	// from their watermarks further back than that.
+	skipBefore time.Time
+}
+
+// newProgress creates a new instance of progress.
+func newProgress() *progress {
+	return &progress{
+		engines: make(map[state.Key]*engineProgress),
+	}
+}
+
+// start returns the start of the next window of the engine, which is its watermark, but not earlier than provided
+// earliest time. Engines seen for the first time get their watermark set to provided defaultSince.
+func (p *progress) start(key state.Key, defaultSince, earliest time.Time) time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ep, ok := p.engines[key]
+	if !ok {
+		ep = p.engine(key)
+		ep.watermark = defaultSince
+	}
+
+	// the windows, which were skipped, are not collected.
+	earliest = later(earliest, p.skipBefore)
+
+	if ep.watermark.Before(earliest) {
+		return earliest
+	}
+
+	return ep.watermark
+}
+
+// skip makes the engines skip the windows before provided time, instead of resuming from their watermarks.
+func (p *progress) skip(before time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.skipBefore = later(p.skipBefore, before)
+}
+
+// watermark returns the end of the last delivered window of the engine, if any.
+func (p *progress) watermark(key state.Key) (time.Time, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ep, ok := p.engines[key]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return ep.watermark, true
+}
+
+// see records the time of a data point of the engine, so that the time of the newest one is known.
+func (p *progress) see(key state.Key, t time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ep := p.engine(key)
+	ep.newest = later(ep.newest, t)
+}
+
+// newest returns the time of the newest data point seen of the engine, if any.
+func (p *progress) newest(key state.Key) (time.Time, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ep, ok := p.engines[key]
+	if !ok || ep.newest.IsZero() {
+		return time.Time{}, false
+	}
+
+	return ep.newest, true
+}
+
+// report marks the query of the engine as reported. It returns false if the query was already reported before.
+func (p *progress) report(key state.Key, queryID string, submittedTime time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ep := p.engine(key)
+	if _, ok := ep.reported[queryID]; ok {
+		return false
+	}
+
+	ep.reported[queryID] = submittedTime
+	return true
+}
+
+// advance moves the watermark of the engine to the end of the delivered window. Reported queries which were
+// submitted before the lookback window of the next collection are forgotten, since they will not be read again.
+func (p *progress) advance(key state.Key, till time.Time, lookback time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ep := p.engine(key)
+	ep.watermark = till
+
+	before := till.Add(-lookback)
+	for queryID, submittedTime := range ep.reported {
+		if !submittedTime.After(before) {
+			delete(ep.reported, queryID)
+		}
+	}
+}
+
+// retain drops the progress of the account's engines, which are not present in the provided list, so that the
+// engines, which were deleted, are not kept in the state forever.
+func (p *progress) retain(accountName string, engines []fetcher.Engine) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	present := make(map[string]struct{}, len(engines))
+	for _, engine := range engines {
+		present[engine.Name] = struct{}{}
+	}
+
+	for key := range p.engines {
+		if key.Account != accountName {
+			continue
+		}
+
+		if _, ok := present[key.Engine]; !ok {
+			delete(p.engines, key)
+		}
+	}
+}
+
+// engine returns the progress of the engine, creating it if needed. It must be called with the lock held.
+func (p *progress) engine(key state.Key) *engineProgress {
+	ep, ok := p.engines[key]
+	if !ok {
+		ep = &engineProgress{reported: make(map[string]time.Time)}
+		p.engines[key] = ep
+	}
+
+	return ep
+}
+
+// restore replaces the progress with the one from provided state.
+func (p *progress) restore(s *state.State) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.engines = make(map[state.Key]*engineProgress, len(s.Engines))
+	for key, es := range s.Engines {
+		reported := make(map[string]time.Time, len(es.ReportedQueries))
+		for queryID, submittedTime := range es.ReportedQueries {
+			reported[queryID] = submittedTime
+		}
+
+		p.engines[key] = &engineProgress{watermark: es.Watermark, reported: reported}
+	}
+}
+
+// snapshot returns the progress as a state, which can be persisted.
+func (p *progress) snapshot() *state.State {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := state.New()
+	for key, ep := range p.engines {
+		reported := make(map[string]time.Time, len(ep.reported))
+		for queryID, submittedTime := range ep.reported {
+			reported[queryID] = submittedTime
+		}
+
+		s.Engines[key] = state.EngineState{Watermark: ep.watermark, ReportedQueries: reported}
+	}
+
+	return s
+}
+
+// restoreState loads the query history progress from the state store. Runtime progress is not persisted.
+func (c *collector) restoreState(ctx context.Context) error {
+	s, err := c.stateStore.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load collector state: %w", err)
+	}
+
+	c.queryHistoryProgress.restore(s)
+	slog.DebugContext(ctx, "collector state restored", slog.Int("engines", len(s.Engines)))
+
+	return nil
+}
+
+// saveState persists the query history progress in the state store.
+func (c *collector) saveState(ctx context.Context) {
+	if err := c.stateStore.Save(ctx, c.queryHistoryProgress.snapshot()); err != nil {
+		slog.ErrorContext(ctx, "failed to save collector state", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,151 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/firebolt-db/otel-exporter/internal/fetcher"
+	"github.com/firebolt-db/otel-exporter/internal/state"
+)
+
+func Test_progress_report(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().UTC()
+	key := state.Key{Account: "acct", Engine: "eng"}
+	p := newProgress()
+
+	require.True(t, p.report(key, "q1", now.Add(-10*time.Minute)))
+	require.True(t, p.report(key, "q2", now.Add(-time.Minute)))
+
+	// already reported queries are skipped
+	require.False(t, p.report(key, "q1", now.Add(-10*time.Minute)))
+	require.False(t, p.report(key, "q2", now.Add(-time.Minute)))
+
+	// queries submitted before the next lookback window are forgotten
+	p.advance(key, now, 5*time.Minute)
+	require.True(t, p.report(key, "q1", now.Add(-10*time.Minute)))
+	require.False(t, p.report(key, "q2", now.Add(-time.Minute)))
+}
+
+func Test_progress_watermark(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().UTC()
+	key := state.Key{Account: "acct", Engine: "eng"}
+	p := newProgress()
+
+	_, ok := p.watermark(key)
+	require.False(t, ok)
+
+	p.advance(key, now, time.Minute)
+	wm, ok := p.watermark(key)
+	require.True(t, ok)
+	require.Equal(t, now, wm)
+}
+
+func Test_progress_retain(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().UTC()
+	kept := state.Key{Account: "acct", Engine: "eng1"}
+	deleted := state.Key{Account: "acct", Engine: "eng2"}
+	other := state.Key{Account: "other", Engine: "eng2"}
+	p := newProgress()
+
+	for _, key := range []state.Key{kept, deleted, other} {
+		p.advance(key, now, time.Minute)
+	}
+
+	// only the engines of the account, which are not present anymore, are dropped
+	p.retain("acct", []fetcher.Engine{{Name: "eng1", Status: "RUNNING"}})
+	require.Len(t, p.snapshot().Engines, 2)
+
+	_, ok := p.watermark(kept)
+	require.True(t, ok)
+	_, ok = p.watermark(deleted)
+	require.False(t, ok)
+	_, ok = p.watermark(other)
+	require.True(t, ok)
+}
+
+func Test_progress_start(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().UTC()
+	key := state.Key{Account: "acct", Engine: "eng"}
+	p := newProgress()
+
+	// engine seen for the first time starts from the default
+	require.Equal(t, now.Add(-time.Minute), p.start(key, now.Add(-time.Minute), now.Add(-time.Hour)))
+	wm, ok := p.watermark(key)
+	require.True(t, ok)
+	require.Equal(t, now.Add(-time.Minute), wm)
+
+	// watermark is not advanced until the window is delivered
+	require.Equal(t, now.Add(-time.Minute), p.start(key, now, now.Add(-time.Hour)))
+
+	// window doesn't start earlier than allowed
+	require.Equal(t, now.Add(-30*time.Second), p.start(key, now, now.Add(-30*time.Second)))
+
+	p.advance(key, now, 0)
+	require.Equal(t, now, p.start(key, now.Add(-time.Minute), now.Add(-time.Hour)))
+}
+
+func Test_progress_snapshot_restore(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().UTC()
+	key := state.Key{Account: "acct", Engine: "eng"}
+	p := newProgress()
+	require.True(t, p.report(key, "q1", now.Add(-time.Minute)))
+	p.advance(key, now, 5*time.Minute)
+
+	s := p.snapshot()
+	require.Equal(t, state.EngineState{
+		Watermark:       now,
+		ReportedQueries: map[string]time.Time{"q1": now.Add(-time.Minute)},
+	}, s.Engines[key])
+
+	restored := newProgress()
+	restored.restore(s)
+
+	wm, ok := restored.watermark(key)
+	require.True(t, ok)
+	require.Equal(t, now, wm)
+	require.False(t, restored.report(key, "q1", now.Add(-time.Minute)))
+}
+
+func Test_progress_start_skip(t *testing.T) {
+	t.Parallel()
+
+	p := newProgress()
+	key := state.Key{Account: "acct", Engine: "engine1"}
+	till := time.Now().UTC()
+
+	// the engine's watermark is within the catch-up period, but before the skipped windows
+	p.advance(key, till.Add(-10*time.Minute), 0)
+	p.skip(till.Add(-time.Minute))
+
+	require.Equal(t, till.Add(-time.Minute), p.start(key, till.Add(-30*time.Second), till.Add(-time.Hour)))
+}
+
+func Test_progress_newest(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().UTC()
+	key := state.Key{Account: "acct", Engine: "eng"}
+	p := newProgress()
+
+	_, ok := p.newest(key)
+	require.False(t, ok)
+
+	// the data points of an engine are not seen in chronological order across the windows
+	p.see(key, now)
+	p.see(key, now.Add(-time.Minute))
+	newest, ok := p.newest(key)
+	require.True(t, ok)
+	require.Equal(t, now, newest)
+}
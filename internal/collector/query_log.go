@@ -0,0 +1,129 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/log"
+
+	"github.com/firebolt-db/otel-exporter/internal/fetcher"
+)
+
+// QueryLogs defines how the queries of the query history are emitted as log records.
+type QueryLogs struct {
+	// Enabled defines whether the queries are emitted as log records. The log records are exported by the log
+	// exporter of the collector.
+	Enabled bool
+	// QueryTextLength is the maximum number of characters of the query text in the log record. The longer query
+	// texts are truncated. Zero means that the query text is not included.
+	QueryTextLength int
+	// RedactQueryText defines whether the literals of the query text and the error message are replaced by `?`,
+	// so that the values of the query don't leak into the logs. It applies to the error message of the query spans
+	// as well.
+	RedactQueryText bool
+}
+
+// emitQueryLog emits the log record of a single query of the query history, if the query logs are enabled.
+// The record has the timestamp of the query submission, and the error severity if the query failed.
+func (c *collector) emitQueryLog(ctx context.Context, accountName string, mp fetcher.QueryHistoryPoint) {
+	if c.queryLogger == nil {
+		return
+	}
+
+	var record log.Record
+	record.SetTimestamp(mp.SubmittedTime.V)
+	record.SetObservedTimestamp(time.Now().UTC())
+	record.SetSeverity(log.SeverityInfo)
+	record.SetSeverityText("INFO")
+
+	queryText, truncated := c.queryLogText(mp.QueryText.String)
+	record.SetBody(log.StringValue(queryText))
+
+	record.AddAttributes(
+		log.String("firebolt.account.name", accountName),
+		log.String("firebolt.engine.name", mp.EngineName),
+		log.String("firebolt.engine.status", mp.EngineStatus),
+		log.String("firebolt.query.id", mp.QueryID.String),
+		log.String("firebolt.user.name", mp.UserName.String),
+		log.String("firebolt.query.status", mp.Status.String),
+		log.String("firebolt.query.type", statementType(mp.QueryText.String)),
+		log.String("firebolt.query.label", mp.QueryLabel.String),
+		log.String("firebolt.query.fingerprint", queryFingerprint(mp.QueryText.String)),
+		log.Bool("firebolt.query.text.truncated", truncated),
+		log.Float64("firebolt.query.duration", float64(mp.DurationMicroSeconds.Int64)/1000000),
+		log.Float64("firebolt.query.queue.time", float64(mp.TimeInQueueMicroSeconds.Int64)/1000000),
+		log.Float64("firebolt.query.gateway.duration", float64(mp.GatewayDurationMicroSeconds.Int64)/1000000),
+		log.Int64("firebolt.query.scanned.rows", mp.ScannedRows.Int64),
+		log.Int64("firebolt.query.scanned.bytes", mp.ScannedBytes.Int64),
+		log.Int64("firebolt.query.insert.rows", mp.InsertedRows.Int64),
+		log.Int64("firebolt.query.insert.bytes", mp.InsertedBytes.Int64),
+		log.Int64("firebolt.query.returned.rows", mp.ReturnedRows.Int64),
+		log.Int64("firebolt.query.returned.bytes", mp.ReturnedBytes.Int64),
+		log.Int64("firebolt.query.spilled.bytes", mp.SpilledBytes.Int64),
+	)
+
+	if errorClass, ok := queryErrorClass(mp); ok {
+		record.SetSeverity(log.SeverityError)
+		record.SetSeverityText("ERROR")
+		record.AddAttributes(
+			log.String("firebolt.query.error.class", errorClass),
+			log.String("firebolt.query.error.fingerprint", c.errorClassifier.Classify(mp.ErrorMessage.String)),
+			log.String("firebolt.query.error.message", c.queryErrorMessage(mp.ErrorMessage.String)),
+		)
+	}
+
+	c.queryLogger.Emit(ctx, record)
+}
+
+// queryLogText returns the query text as it's included in the log record, and whether it was truncated. The query
+// text, which is not included on purpose, is not reported as truncated.
+func (c *collector) queryLogText(queryText string) (string, bool) {
+	if c.queryLogs.QueryTextLength <= 0 {
+		return "", false
+	}
+
+	if c.queryLogs.RedactQueryText {
+		queryText = redactQuery(queryText)
+	}
+
+	runes := []rune(queryText)
+	if len(runes) <= c.queryLogs.QueryTextLength {
+		return queryText, false
+	}
+
+	return string(runes[:c.queryLogs.QueryTextLength]), true
+}
+
+// queryErrorMessage returns the error message as it's included in the log record and the status of the query span.
+// The error messages may quote the literals of the query, so they are redacted the same way as the query text.
+func (c *collector) queryErrorMessage(errorMessage string) string {
+	if c.queryLogs.RedactQueryText {
+		return redactQuery(errorMessage)
+	}
+
+	return errorMessage
+}
+
+// redactQuery returns the query text with the string and numeric literals replaced by `?`. Unlike normalizeQuery,
+// it keeps the rest of the query text as it is.
+func redactQuery(queryText string) string {
+	runes := []rune(queryText)
+	redacted := make([]rune, 0, len(runes))
+
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case literalStart(runes, i):
+			i = literalEnd(runes, i)
+			redacted = append(redacted, '?')
+		case runes[i] == '"':
+			// quoted identifiers are kept, even though they may contain digits.
+			end := quotedIdentifierEnd(runes, i)
+			redacted = append(redacted, runes[i:end+1]...)
+			i = end
+		default:
+			redacted = append(redacted, runes[i])
+		}
+	}
+
+	return string(redacted)
+}
@@ -0,0 +1,168 @@
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+
+	"github.com/firebolt-db/otel-exporter/internal/fetcher"
+)
+
+func Test_redactQuery(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t,
+		`SELECT "Col1" FROM t1 WHERE id = ? AND name = ? AND price > ?`,
+		redactQuery(`SELECT "Col1" FROM t1 WHERE id = 42 AND name = 'it''s' AND price > 1.5`),
+	)
+
+	// literals and identifiers, which are not closed, last until the end of the query text
+	require.Equal(t, `SELECT ?`, redactQuery(`SELECT 'it''s`))
+	require.Equal(t, `SELECT "a1`, redactQuery(`SELECT "a1`))
+}
+
+func Test_collector_queryLogText(t *testing.T) {
+	t.Parallel()
+
+	c := &collector{queryLogs: QueryLogs{QueryTextLength: 8}}
+	text, truncated := c.queryLogText("SELECT 1")
+	require.Equal(t, "SELECT 1", text)
+	require.False(t, truncated)
+
+	text, truncated = c.queryLogText("SELECT 42")
+	require.Equal(t, "SELECT 4", text)
+	require.True(t, truncated)
+
+	// the query text, which is left out on purpose, is not truncated
+	c = &collector{queryLogs: QueryLogs{QueryTextLength: 0}}
+	text, truncated = c.queryLogText("SELECT 42")
+	require.Empty(t, text)
+	require.False(t, truncated)
+}
+
+func Test_Collector_collectQueryHistoryMetrics_queryLogs(t *testing.T) {
+	t.Parallel()
+
+	acctName := "acct"
+	till := time.Now().UTC()
+	since := till.Add(-time.Minute)
+	submittedTime := since.Add(time.Second)
+
+	f := newFetcherMock()
+	logExp := &logExporterMock{}
+	c, err := NewCollector(f, []string{acctName}, WithExporter(newExporterMock()),
+		WithLogExporter(logExp),
+		WithQueryLogs(QueryLogs{Enabled: true, QueryTextLength: 30, RedactQueryText: true}),
+	)
+	require.NoError(t, err)
+
+	col := c.(*collector)
+	f.fetchQueryHistoryPointsFn = func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) (<-chan fetcher.QueryHistoryPoint, <-chan error) {
+		ch := make(chan fetcher.QueryHistoryPoint, 2)
+		ch <- fetcher.QueryHistoryPoint{
+			EngineName:           "engine1",
+			QueryID:              sql.NullString{Valid: true, String: "q1"},
+			SubmittedTime:        sql.Null[time.Time]{Valid: true, V: submittedTime},
+			UserName:             sql.NullString{Valid: true, String: "alice"},
+			Status:               sql.NullString{Valid: true, String: "ENDED_SUCCESSFULLY"},
+			QueryText:            sql.NullString{Valid: true, String: "SELECT * FROM orders WHERE id = 42"},
+			DurationMicroSeconds: sql.NullInt64{Valid: true, Int64: 1500000},
+			ScannedBytes:         sql.NullInt64{Valid: true, Int64: 100},
+		}
+		ch <- fetcher.QueryHistoryPoint{
+			EngineName:    "engine1",
+			QueryID:       sql.NullString{Valid: true, String: "q2"},
+			SubmittedTime: sql.Null[time.Time]{Valid: true, V: submittedTime},
+			Status:        sql.NullString{Valid: true, String: "EXECUTION_ERROR"},
+			QueryText:     sql.NullString{Valid: true, String: "SELECT 1/0"},
+			ErrorMessage:  sql.NullString{Valid: true, String: "Out of memory while reading 'alice@example.com' at row 42"},
+		}
+		close(ch)
+
+		return ch, closedErrCh()
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	col.collectQueryHistoryMetrics(context.Background(), wg, acctName, []fetcher.Engine{{Name: "engine1", Status: "RUNNING"}}, since, till)
+	wg.Wait()
+
+	// the log records are exported once the collector is closed
+	require.NoError(t, c.Close(context.Background()))
+
+	records := logExp.exported()
+	require.Len(t, records, 2)
+
+	attrs := func(r sdklog.Record) map[string]log.Value {
+		values := make(map[string]log.Value)
+		r.WalkAttributes(func(kv log.KeyValue) bool {
+			values[kv.Key] = kv.Value
+			return true
+		})
+		return values
+	}
+
+	succeeded := records[0]
+	require.Equal(t, submittedTime, succeeded.Timestamp())
+	require.Equal(t, log.SeverityInfo, succeeded.Severity())
+	require.Equal(t, "SELECT * FROM orders WHERE id ", succeeded.Body().AsString())
+
+	succeededAttrs := attrs(succeeded)
+	require.Equal(t, "q1", succeededAttrs["firebolt.query.id"].AsString())
+	require.Equal(t, "alice", succeededAttrs["firebolt.user.name"].AsString())
+	require.Equal(t, "SELECT", succeededAttrs["firebolt.query.type"].AsString())
+	require.Equal(t, 1.5, succeededAttrs["firebolt.query.duration"].AsFloat64())
+	require.Equal(t, int64(100), succeededAttrs["firebolt.query.scanned.bytes"].AsInt64())
+	require.True(t, succeededAttrs["firebolt.query.text.truncated"].AsBool())
+	require.NotContains(t, succeededAttrs, "firebolt.query.error.message")
+
+	failed := records[1]
+	require.Equal(t, log.SeverityError, failed.Severity())
+	require.Equal(t, "SELECT ?/?", failed.Body().AsString())
+
+	failedAttrs := attrs(failed)
+	require.Equal(t, "execution", failedAttrs["firebolt.query.error.class"].AsString())
+	require.Equal(t, "out_of_memory", failedAttrs["firebolt.query.error.fingerprint"].AsString())
+	// the error message quotes the literals of the query, so it's redacted as well
+	require.Equal(t, "Out of memory while reading ? at row ?", failedAttrs["firebolt.query.error.message"].AsString())
+	require.False(t, failedAttrs["firebolt.query.text.truncated"].AsBool())
+}
+
+// logExporterMock keeps the exported log records.
+type logExporterMock struct {
+	mu      sync.Mutex
+	records []sdklog.Record
+}
+
+var _ sdklog.Exporter = (*logExporterMock)(nil)
+
+func (m *logExporterMock) Export(_ context.Context, records []sdklog.Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range records {
+		m.records = append(m.records, r.Clone())
+	}
+	return nil
+}
+
+func (m *logExporterMock) Shutdown(context.Context) error {
+	return nil
+}
+
+func (m *logExporterMock) ForceFlush(context.Context) error {
+	return nil
+}
+
+func (m *logExporterMock) exported() []sdklog.Record {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.records
+}
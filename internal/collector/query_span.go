@@ -0,0 +1,94 @@
+package collector
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/firebolt-db/otel-exporter/internal/fetcher"
+)
+
+// traceparentRegexp matches a W3C traceparent within a query label, e.g. `app=web;00-<trace id>-<span id>-01`.
+var traceparentRegexp = regexp.MustCompile(`[0-9a-f]{2}-[0-9a-f]{32}-[0-9a-f]{16}-[0-9a-f]{2}`)
+
+// emitQuerySpan emits the span of a single query of the query history, if the query spans are enabled.
+// The span lasts from the submission till the end of the query, and has the child spans of the time
+// the query spent in the queue and executing. If the query label carries a traceparent, the span is
+// a child of the caller's span, so that it shows up in the caller's trace.
+func (c *collector) emitQuerySpan(ctx context.Context, accountName string, mp fetcher.QueryHistoryPoint) {
+	if c.queryTracer == nil {
+		return
+	}
+
+	submitted, started, ended := querySpanTimes(mp)
+
+	ctx = queryTraceContext(ctx, mp.QueryLabel.String)
+	ctx, span := c.queryTracer.Start(ctx, statementType(mp.QueryText.String),
+		trace.WithTimestamp(submitted),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.DBSystemKey.String("firebolt"),
+			attribute.String("firebolt.account.name", accountName),
+			attribute.String("firebolt.engine.name", mp.EngineName),
+			attribute.String("firebolt.user.name", mp.UserName.String),
+			attribute.String("firebolt.query.id", mp.QueryID.String),
+			attribute.String("firebolt.query.status", mp.Status.String),
+		),
+	)
+
+	_, queue := c.queryTracer.Start(ctx, "queue", trace.WithTimestamp(submitted))
+	queue.End(trace.WithTimestamp(started))
+
+	_, execution := c.queryTracer.Start(ctx, "execution", trace.WithTimestamp(started))
+
+	if errorClass, ok := queryErrorClass(mp); ok {
+		span.SetAttributes(attribute.String("firebolt.query.error.class", errorClass))
+		errorMessage := c.queryErrorMessage(mp.ErrorMessage.String)
+		span.SetStatus(codes.Error, errorMessage)
+		execution.SetStatus(codes.Error, errorMessage)
+	}
+
+	execution.End(trace.WithTimestamp(ended))
+	span.End(trace.WithTimestamp(ended))
+}
+
+// querySpanTimes returns the times the query was submitted, started and ended at. The start and end times, which
+// are not reported, are told by the time in queue and the duration of the query.
+func querySpanTimes(mp fetcher.QueryHistoryPoint) (submitted, started, ended time.Time) {
+	submitted = mp.SubmittedTime.V
+
+	started = submitted.Add(time.Duration(mp.TimeInQueueMicroSeconds.Int64) * time.Microsecond)
+	if mp.StartTime.Valid {
+		started = mp.StartTime.V
+	}
+
+	ended = started.Add(time.Duration(mp.DurationMicroSeconds.Int64) * time.Microsecond)
+	if mp.EndTime.Valid {
+		ended = mp.EndTime.V
+	}
+
+	// the times are not expected to be out of order, but the spans must not end before they start either way.
+	started = later(started, submitted)
+	ended = later(ended, started)
+
+	return submitted, started, ended
+}
+
+// queryTraceContext returns the context, which the span of the query is started in. It carries the caller's span,
+// if the query label has a valid traceparent, and no span otherwise, so that the query starts a new trace.
+func queryTraceContext(ctx context.Context, queryLabel string) context.Context {
+	ctx = trace.ContextWithSpanContext(ctx, trace.SpanContext{})
+
+	traceparent := traceparentRegexp.FindString(queryLabel)
+	if traceparent == "" {
+		return ctx
+	}
+
+	return propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{"traceparent": traceparent})
+}
@@ -0,0 +1,206 @@
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/firebolt-db/otel-exporter/internal/fetcher"
+)
+
+func Test_querySpanTimes(t *testing.T) {
+	t.Parallel()
+
+	submitted := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("reported times", func(t *testing.T) {
+		t.Parallel()
+
+		s, b, e := querySpanTimes(fetcher.QueryHistoryPoint{
+			SubmittedTime: sql.Null[time.Time]{Valid: true, V: submitted},
+			StartTime:     sql.Null[time.Time]{Valid: true, V: submitted.Add(time.Second)},
+			EndTime:       sql.Null[time.Time]{Valid: true, V: submitted.Add(3 * time.Second)},
+		})
+		require.Equal(t, submitted, s)
+		require.Equal(t, submitted.Add(time.Second), b)
+		require.Equal(t, submitted.Add(3*time.Second), e)
+	})
+
+	t.Run("times told by durations", func(t *testing.T) {
+		t.Parallel()
+
+		s, b, e := querySpanTimes(fetcher.QueryHistoryPoint{
+			SubmittedTime:           sql.Null[time.Time]{Valid: true, V: submitted},
+			TimeInQueueMicroSeconds: sql.NullInt64{Valid: true, Int64: 500000},
+			DurationMicroSeconds:    sql.NullInt64{Valid: true, Int64: 2000000},
+		})
+		require.Equal(t, submitted, s)
+		require.Equal(t, submitted.Add(500*time.Millisecond), b)
+		require.Equal(t, submitted.Add(2500*time.Millisecond), e)
+	})
+
+	t.Run("out of order times", func(t *testing.T) {
+		t.Parallel()
+
+		s, b, e := querySpanTimes(fetcher.QueryHistoryPoint{
+			SubmittedTime: sql.Null[time.Time]{Valid: true, V: submitted},
+			StartTime:     sql.Null[time.Time]{Valid: true, V: submitted.Add(-time.Second)},
+			EndTime:       sql.Null[time.Time]{Valid: true, V: submitted.Add(-2 * time.Second)},
+		})
+		require.Equal(t, submitted, s)
+		require.Equal(t, submitted, b)
+		require.Equal(t, submitted, e)
+	})
+}
+
+func Test_queryTraceContext(t *testing.T) {
+	t.Parallel()
+
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NoError(t, err)
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	require.NoError(t, err)
+
+	for _, label := range []string{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"app=web;traceparent=00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		sc := trace.SpanContextFromContext(queryTraceContext(context.Background(), label))
+		require.True(t, sc.IsRemote(), label)
+		require.Equal(t, traceID, sc.TraceID(), label)
+		require.Equal(t, spanID, sc.SpanID(), label)
+		require.True(t, sc.IsSampled(), label)
+	}
+
+	for _, label := range []string{
+		"",
+		"dbt",
+		// the trace id must not be all zeros.
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+	} {
+		sc := trace.SpanContextFromContext(queryTraceContext(context.Background(), label))
+		require.False(t, sc.IsValid(), label)
+	}
+}
+
+func Test_Collector_collectQueryHistoryMetrics_querySpans(t *testing.T) {
+	t.Parallel()
+
+	acctName := "acct"
+	till := time.Now().UTC()
+	since := till.Add(-time.Minute)
+	submittedTime := since.Add(time.Second)
+
+	f := newFetcherMock()
+	spanExp := tracetest.NewInMemoryExporter()
+	c, err := NewCollector(f, []string{acctName}, WithExporter(newExporterMock()),
+		WithQuerySpans(spanExp),
+		WithQueryLogs(QueryLogs{RedactQueryText: true}),
+	)
+	require.NoError(t, err)
+
+	col := c.(*collector)
+	f.fetchQueryHistoryPointsFn = func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) (<-chan fetcher.QueryHistoryPoint, <-chan error) {
+		ch := make(chan fetcher.QueryHistoryPoint, 2)
+		ch <- fetcher.QueryHistoryPoint{
+			EngineName:    "engine1",
+			QueryID:       sql.NullString{Valid: true, String: "q1"},
+			SubmittedTime: sql.Null[time.Time]{Valid: true, V: submittedTime},
+			StartTime:     sql.Null[time.Time]{Valid: true, V: submittedTime.Add(time.Second)},
+			EndTime:       sql.Null[time.Time]{Valid: true, V: submittedTime.Add(3 * time.Second)},
+			UserName:      sql.NullString{Valid: true, String: "alice"},
+			Status:        sql.NullString{Valid: true, String: "ENDED_SUCCESSFULLY"},
+			QueryLabel:    sql.NullString{Valid: true, String: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+			QueryText:     sql.NullString{Valid: true, String: "SELECT 1"},
+		}
+		ch <- fetcher.QueryHistoryPoint{
+			EngineName:    "engine1",
+			QueryID:       sql.NullString{Valid: true, String: "q2"},
+			SubmittedTime: sql.Null[time.Time]{Valid: true, V: submittedTime},
+			Status:        sql.NullString{Valid: true, String: "EXECUTION_ERROR"},
+			QueryText:     sql.NullString{Valid: true, String: "INSERT INTO t VALUES (1)"},
+			ErrorMessage:  sql.NullString{Valid: true, String: "Out of memory while reading 'alice@example.com' at row 42"},
+		}
+		close(ch)
+
+		return ch, closedErrCh()
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	col.collectQueryHistoryMetrics(context.Background(), wg, acctName, []fetcher.Engine{{Name: "engine1", Status: "RUNNING"}}, since, till)
+	wg.Wait()
+
+	// the in-memory exporter drops the spans on shutdown, so they are flushed before the collector is closed.
+	require.NoError(t, col.tracerProvider.ForceFlush(context.Background()))
+	spans := spanExp.GetSpans()
+	require.NoError(t, c.Close(context.Background()))
+
+	require.Len(t, spans, 6)
+
+	// the spans of the first query are in the caller's trace.
+	byName := make(map[string]tracetest.SpanStub)
+	for _, span := range spans {
+		if span.SpanContext.TraceID().String() == "4bf92f3577b34da6a3ce929d0e0e4736" {
+			byName[span.Name] = span
+		}
+	}
+	require.Len(t, byName, 3)
+
+	query := byName["SELECT"]
+	require.Equal(t, trace.SpanKindServer, query.SpanKind)
+	require.Equal(t, submittedTime, query.StartTime)
+	require.Equal(t, submittedTime.Add(3*time.Second), query.EndTime)
+	require.True(t, query.Parent.IsRemote())
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", query.SpanContext.TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", query.Parent.SpanID().String())
+	require.Subset(t, query.Attributes, []attribute.KeyValue{
+		attribute.String("db.system", "firebolt"),
+		attribute.String("firebolt.account.name", acctName),
+		attribute.String("firebolt.engine.name", "engine1"),
+		attribute.String("firebolt.user.name", "alice"),
+		attribute.String("firebolt.query.id", "q1"),
+		attribute.String("firebolt.query.status", "ENDED_SUCCESSFULLY"),
+	})
+	require.Equal(t, codes.Unset, query.Status.Code)
+
+	queue := byName["queue"]
+	require.Equal(t, query.SpanContext.SpanID(), queue.Parent.SpanID())
+	require.Equal(t, submittedTime, queue.StartTime)
+	require.Equal(t, submittedTime.Add(time.Second), queue.EndTime)
+
+	execution := byName["execution"]
+	require.Equal(t, query.SpanContext.SpanID(), execution.Parent.SpanID())
+	require.Equal(t, submittedTime.Add(time.Second), execution.StartTime)
+	require.Equal(t, submittedTime.Add(3*time.Second), execution.EndTime)
+
+	var failed tracetest.SpanStub
+	for _, span := range spans {
+		if span.Name == "INSERT" {
+			failed = span
+		}
+	}
+	require.False(t, failed.Parent.IsValid())
+	require.NotEqual(t, "4bf92f3577b34da6a3ce929d0e0e4736", failed.SpanContext.TraceID().String())
+	require.Equal(t, codes.Error, failed.Status.Code)
+	// the error message quotes the literals of the query, so it's redacted as well
+	require.Equal(t, "Out of memory while reading ? at row ?", failed.Status.Description)
+	require.Contains(t, failed.Attributes, attribute.String("firebolt.query.error.class", "execution"))
+
+	var failedExecution tracetest.SpanStub
+	for _, span := range spans {
+		if span.Name == "execution" && span.Parent.SpanID() == failed.SpanContext.SpanID() {
+			failedExecution = span
+		}
+	}
+	require.Equal(t, codes.Error, failedExecution.Status.Code)
+	require.Equal(t, "Out of memory while reading ? at row ?", failedExecution.Status.Description)
+}
@@ -0,0 +1,185 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// OverrunPolicy defines how the Collector proceeds, when a collection cycle runs past the boundary of the next one.
+type OverrunPolicy string
+
+const (
+	// OverrunSkip drops the windows, which boundaries passed during the overrun, so that their data is not collected.
+	// The collection proceeds with the window of the next boundary.
+	OverrunSkip OverrunPolicy = "skip"
+
+	// OverrunCatchUp collects the windows, which boundaries passed during the overrun, one by one and without waiting,
+	// until the collection catches up with the current time.
+	OverrunCatchUp OverrunPolicy = "catchup"
+
+	// OverrunMerge collects the windows, which boundaries passed during the overrun, in a single cycle right away.
+	OverrunMerge OverrunPolicy = "merge"
+)
+
+// Schedule defines when a source of the metrics is collected.
+type Schedule struct {
+	// Enabled defines whether the source is collected at all.
+	Enabled bool
+	// Interval is the size of the collection windows of the source. Zero means the interval provided to Start.
+	Interval time.Duration
+	// Offset delays the collection of each window, so that its data has time to land in Firebolt.
+	Offset time.Duration
+}
+
+// source is a source of the engine metrics, which is collected on its own schedule.
+type source struct {
+	name     string
+	collect  collectorFn
+	progress *progress
+	schedule Schedule
+	// persisted defines whether the progress of the source is kept in the state store.
+	persisted bool
+	// finishCycle is called once all the accounts of a cycle are collected, if it's set.
+	finishCycle func()
+}
+
+// sources returns all the sources of the engine metrics.
+func (c *collector) sources() []source {
+	return []source{
+		{
+			name:     "runtime",
+			collect:  c.collectRuntimeMetrics,
+			progress: c.runtimeProgress,
+			schedule: c.runtimeSchedule,
+		},
+		{
+			name:      "query_history",
+			collect:   c.collectQueryHistoryMetrics,
+			progress:  c.queryHistoryProgress,
+			schedule:  c.queryHistorySchedule,
+			persisted: true,
+			// the query labels reported in the next cycle are ranked by their queries in this one.
+			finishCycle: c.rotateQueryLabels,
+		},
+	}
+}
+
+// runSource runs the collection routine of the source until provided context is done. The first cycle runs right
+// away, the following ones run on the boundaries of the interval, delayed by the offset of the source, so that each
+// cycle collects the window between two consecutive boundaries. Cycles which run past the next boundary are handled
+// according to the overrun policy.
+func (c *collector) runSource(ctx context.Context, src source, defaultInterval time.Duration) {
+	interval := src.schedule.Interval
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+
+	c.syncClock(ctx)
+
+	till := c.clock.now().Add(-src.schedule.Offset)
+	since := earlier(c.lastCycleTime, till)
+
+	for {
+		slog.DebugContext(ctx, "start collecting routine",
+			slog.String("source", src.name), slog.Time("since", since), slog.Time("till", till),
+		)
+
+		startedAt := c.clock.now()
+
+		func() {
+			defer c.reportExporterDuration(ctx, src.name, startedAt)
+
+			// the cycle is cut short once the cycle timeout passes, so that the engines which were not
+			// collected in time resume from their watermarks on the next cycle.
+			cycleCtx, cancel := c.cycleContext(ctx)
+			defer cancel()
+
+			// accounts are collected in parallel on a bounded pool of workers.
+			c.forEachAccount(func(acctName string) {
+				c.collectAccount(cycleCtx, src, acctName, since, till)
+			})
+
+			if src.finishCycle != nil {
+				src.finishCycle()
+			}
+
+			if errors.Is(cycleCtx.Err(), context.DeadlineExceeded) {
+				slog.WarnContext(ctx, "collecting routine timed out",
+					slog.String("source", src.name), slog.Duration("timeout", c.cycleTimeout),
+				)
+			}
+
+			if src.persisted {
+				c.saveState(ctx)
+			}
+		}()
+
+		slog.DebugContext(ctx, "finished collecting routine", slog.String("source", src.name))
+
+		since, till = c.nextCycle(ctx, src, startedAt, till, interval)
+
+		timer := time.NewTimer(c.clock.until(till.Add(src.schedule.Offset)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		// the skew is read again before each cycle, so that the window of the next cycle is based on it.
+		c.syncClock(ctx)
+	}
+}
+
+// nextCycle returns the window of the cycle of the source following the one, which started at provided time and
+// collected the window till provided time. The cycle is expected to run once its window ends and the offset of the
+// source passes. In case the next cycle is already due, the next window is chosen according to the overrun policy.
+func (c *collector) nextCycle(ctx context.Context, src source, startedAt, till time.Time, interval time.Duration) (time.Time, time.Time) {
+	next := till.Truncate(interval).Add(interval)
+
+	// the boundaries are compared with the time shifted by the offset, since the cycles are delayed by it.
+	now := c.clock.now().Add(-src.schedule.Offset)
+	if now.Before(next) {
+		return till, next
+	}
+
+	attrs := metric.WithAttributes(attribute.Key("firebolt.exporter.source").String(src.name))
+
+	// the cycle overran if a boundary passed while it was running. Otherwise, the collection is still catching up
+	// with the windows missed before the cycle started.
+	if now.Truncate(interval).After(startedAt.Add(-src.schedule.Offset).Truncate(interval)) {
+		c.exporterMetrics.overrunCycles.Add(ctx, 1, attrs)
+		slog.WarnContext(ctx, "collecting routine overran the interval",
+			slog.String("source", src.name), slog.Duration("interval", interval),
+			slog.String("policy", string(c.overrunPolicy)),
+		)
+	}
+
+	// latest is the latest boundary, which already passed, and missed is the number of windows ending after
+	// the collected one, which are due.
+	missed := int64(now.Sub(next)/interval) + 1
+	latest := next.Add(time.Duration(missed-1) * interval)
+
+	switch c.overrunPolicy {
+	case OverrunSkip:
+		// the engines must not resume from the windows, which are skipped.
+		src.progress.skip(latest)
+		c.exporterMetrics.skippedCycles.Add(ctx, missed, attrs)
+
+		slog.WarnContext(ctx, "skipping collection windows",
+			slog.String("source", src.name), slog.Int64("windows", missed),
+			slog.Time("since", till), slog.Time("till", latest),
+		)
+
+		return latest, latest.Add(interval)
+	case OverrunCatchUp:
+		return till, next
+	default:
+		return till, latest
+	}
+}
@@ -0,0 +1,172 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/firebolt-db/otel-exporter/internal/fetcher"
+)
+
+func Test_Collector_nextCycle(t *testing.T) {
+	t.Parallel()
+
+	interval := time.Hour
+	now := time.Now().UTC()
+	boundary := now.Truncate(interval)
+
+	for name, tc := range map[string]struct {
+		policy    OverrunPolicy
+		startedAt time.Time
+		till      time.Time
+
+		expectedSince      time.Time
+		expectedTill       time.Time
+		expectedSkipBefore time.Time
+		expectedOverrun    int64
+		expectedSkipped    int64
+	}{
+		"in time": {
+			policy:        OverrunMerge,
+			startedAt:     now,
+			till:          now,
+			expectedSince: now,
+			expectedTill:  boundary.Add(interval),
+		},
+		"merge": {
+			policy:          OverrunMerge,
+			startedAt:       boundary.Add(-3 * interval),
+			till:            boundary.Add(-3 * interval),
+			expectedSince:   boundary.Add(-3 * interval),
+			expectedTill:    boundary,
+			expectedOverrun: 1,
+		},
+		"catch up": {
+			policy:          OverrunCatchUp,
+			startedAt:       boundary.Add(-3 * interval),
+			till:            boundary.Add(-3 * interval),
+			expectedSince:   boundary.Add(-3 * interval),
+			expectedTill:    boundary.Add(-2 * interval),
+			expectedOverrun: 1,
+		},
+		"catching up": {
+			// the cycle started late, but didn't overrun
+			policy:        OverrunCatchUp,
+			startedAt:     now,
+			till:          boundary.Add(-2 * interval),
+			expectedSince: boundary.Add(-2 * interval),
+			expectedTill:  boundary.Add(-interval),
+		},
+		"skip": {
+			policy:             OverrunSkip,
+			startedAt:          boundary.Add(-3 * interval),
+			till:               boundary.Add(-3 * interval),
+			expectedSince:      boundary,
+			expectedTill:       boundary.Add(interval),
+			expectedSkipBefore: boundary,
+			expectedOverrun:    1,
+			expectedSkipped:    3,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var mu sync.Mutex
+			sums := make(map[string]int64)
+
+			exp := newExporterMock()
+			exp.exportFn = func(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+				mu.Lock()
+				defer mu.Unlock()
+
+				for _, sm := range rm.ScopeMetrics {
+					for _, m := range sm.Metrics {
+						if data, ok := m.Data.(metricdata.Sum[int64]); ok && len(data.DataPoints) > 0 {
+							sums[m.Name] = data.DataPoints[0].Value
+						}
+					}
+				}
+				return nil
+			}
+
+			c, err := NewCollector(newFetcherMock(), []string{"acct"}, WithExporter(exp), WithOverrunPolicy(tc.policy))
+			require.NoError(t, err)
+			t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+			col := c.(*collector)
+			src := col.sources()[0]
+
+			since, till := col.nextCycle(context.Background(), src, tc.startedAt, tc.till, interval)
+			require.Equal(t, tc.expectedSince, since)
+			require.Equal(t, tc.expectedTill, till)
+			require.Equal(t, tc.expectedSkipBefore, src.progress.skipBefore)
+
+			require.NoError(t, col.meterProvider.ForceFlush(context.Background()))
+
+			mu.Lock()
+			defer mu.Unlock()
+			require.Equal(t, tc.expectedOverrun, sums["firebolt.exporter.cycles.overrun"])
+			require.Equal(t, tc.expectedSkipped, sums["firebolt.exporter.cycles.skipped"])
+		})
+	}
+}
+
+func Test_Collector_nextCycle_offset(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewCollector(newFetcherMock(), []string{"acct"}, WithExporter(newExporterMock()),
+		WithQueryHistorySchedule(Schedule{Enabled: true, Offset: 2 * time.Hour}),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+	col := c.(*collector)
+	src := col.sources()[1]
+
+	interval := time.Hour
+	now := time.Now().UTC()
+	till := now.Add(-2 * time.Hour)
+
+	// the window ending an hour ago is not due until the offset passes after it
+	since, next := col.nextCycle(context.Background(), src, now, till, interval)
+	require.Equal(t, till, since)
+	require.Equal(t, till.Truncate(interval).Add(interval), next)
+}
+
+func Test_Collector_Start_disabledSource(t *testing.T) {
+	t.Parallel()
+
+	f := newFetcherMock()
+	f.fetchEnginesFn = func(ctx context.Context, accountName string) ([]fetcher.Engine, error) {
+		return []fetcher.Engine{{Name: "engine1", Status: "RUNNING"}}, nil
+	}
+
+	var runtimeCycles atomic.Int32
+	f.fetchRuntimePointsFn = func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) (<-chan fetcher.EngineRuntimePoint, <-chan error) {
+		runtimeCycles.Add(1)
+
+		ch := make(chan fetcher.EngineRuntimePoint)
+		close(ch)
+		return ch, closedErrCh()
+	}
+	// the query history is not collected, so the default FetchQueryHistoryPoints of the mock would panic.
+
+	c, err := NewCollector(f, []string{"acct"}, WithExporter(newExporterMock()),
+		WithRuntimeSchedule(Schedule{Enabled: true, Interval: 10 * time.Millisecond}),
+		WithQueryHistorySchedule(Schedule{Enabled: false}),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	t.Cleanup(cancel)
+
+	// the runtime metrics are collected with their own interval rather than the one provided to Start
+	require.NoError(t, c.Start(ctx, time.Hour))
+	require.Greater(t, runtimeCycles.Load(), int32(1))
+}
@@ -0,0 +1,177 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/log"
+
+	"github.com/firebolt-db/otel-exporter/internal/fetcher"
+	"github.com/firebolt-db/otel-exporter/internal/slowquery"
+)
+
+// SlowQueries defines which queries of the query history are slow, and how they are reported.
+type SlowQueries struct {
+	// Enabled defines whether the slow queries are reported at all.
+	Enabled bool
+	// Rules define the thresholds of the queries of each engine and user, and how the query texts are redacted.
+	Rules slowquery.Rules
+	// Writer receives the events of the slow queries as JSON lines. Unless it's set, the events are emitted
+	// as log records, which are exported by the log exporter of the collector.
+	Writer io.Writer
+}
+
+// slowQueryEvent is the event of a single slow query.
+type slowQueryEvent struct {
+	Time        time.Time `json:"time"`
+	Account     string    `json:"account"`
+	Engine      string    `json:"engine"`
+	User        string    `json:"user"`
+	QueryID     string    `json:"query_id"`
+	Status      string    `json:"status"`
+	Type        string    `json:"type"`
+	Label       string    `json:"label,omitempty"`
+	Fingerprint string    `json:"fingerprint"`
+	// Reasons are the thresholds the query exceeded.
+	Reasons []string `json:"reasons"`
+
+	Duration            float64 `json:"duration_seconds"`
+	QueueTime           float64 `json:"queue_time_seconds"`
+	CPUUsage            float64 `json:"cpu_usage_seconds"`
+	CPUDelay            float64 `json:"cpu_delay_seconds"`
+	ScannedRows         int64   `json:"scanned_rows"`
+	ScannedBytes        int64   `json:"scanned_bytes"`
+	ScannedCacheBytes   int64   `json:"scanned_cache_bytes"`
+	ScannedStorageBytes int64   `json:"scanned_storage_bytes"`
+	SpilledBytes        int64   `json:"spilled_bytes"`
+
+	ErrorMessage string `json:"error_message,omitempty"`
+	QueryText    string `json:"query_text"`
+}
+
+// reportSlowQuery counts the query at the time ts and reports its event, if it exceeds any of the thresholds
+// of its engine or user.
+func (c *collector) reportSlowQuery(ctx context.Context, accountName string, ts time.Time, mp fetcher.QueryHistoryPoint) {
+	if !c.slowQueries.Enabled {
+		return
+	}
+
+	thresholds := c.slowQueries.Rules.Thresholds(mp.EngineName, mp.UserName.String)
+	reasons := thresholds.Exceeded(
+		time.Duration(mp.DurationMicroSeconds.Int64)*time.Microsecond,
+		time.Duration(mp.TimeInQueueMicroSeconds.Int64)*time.Microsecond,
+		mp.ScannedBytes.Int64,
+	)
+	if len(reasons) == 0 {
+		return
+	}
+
+	queryType := statementType(mp.QueryText.String)
+
+	c.queryHistoryMetrics.slowQueries.Add(ts, 1, attribute.NewSet(
+		attribute.Key("firebolt.account.name").String(accountName),
+		attribute.Key("firebolt.engine.name").String(mp.EngineName),
+		attribute.Key("firebolt.user.name").String(mp.UserName.String),
+		attribute.Key("firebolt.query.type").String(queryType),
+	))
+
+	// the error messages may quote the query, so they are redacted the same way as the query text.
+	event := slowQueryEvent{
+		Time:                mp.SubmittedTime.V,
+		Account:             accountName,
+		Engine:              mp.EngineName,
+		User:                mp.UserName.String,
+		QueryID:             mp.QueryID.String,
+		Status:              mp.Status.String,
+		Type:                queryType,
+		Label:               mp.QueryLabel.String,
+		Fingerprint:         queryFingerprint(mp.QueryText.String),
+		Reasons:             reasons,
+		Duration:            float64(mp.DurationMicroSeconds.Int64) / 1000000,
+		QueueTime:           float64(mp.TimeInQueueMicroSeconds.Int64) / 1000000,
+		CPUUsage:            float64(mp.CPUUsageMicroSeconds.Int64) / 1000000,
+		CPUDelay:            float64(mp.CPUDelayMicroSeconds.Int64) / 1000000,
+		ScannedRows:         mp.ScannedRows.Int64,
+		ScannedBytes:        mp.ScannedBytes.Int64,
+		ScannedCacheBytes:   mp.ScannedCacheBytes.Int64,
+		ScannedStorageBytes: mp.ScannedStorageBytes.Int64,
+		SpilledBytes:        mp.SpilledBytes.Int64,
+		ErrorMessage:        c.slowQueries.Rules.RedactQuery(mp.ErrorMessage.String),
+		QueryText:           c.slowQueries.Rules.RedactQuery(mp.QueryText.String),
+	}
+
+	if c.slowQueries.Writer != nil {
+		c.writeSlowQuery(ctx, event)
+		return
+	}
+
+	c.emitSlowQuery(ctx, event)
+}
+
+// writeSlowQuery writes the event of the slow query as a single JSON line. The events of the accounts, which
+// are collected concurrently, are written one at a time, so that the lines don't interleave.
+func (c *collector) writeSlowQuery(ctx context.Context, event slowQueryEvent) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to encode slow query event", slog.Any("error", err))
+		return
+	}
+
+	c.slowQueryWriterMu.Lock()
+	defer c.slowQueryWriterMu.Unlock()
+
+	if _, err := c.slowQueries.Writer.Write(append(line, '\n')); err != nil {
+		slog.ErrorContext(ctx, "failed to write slow query event", slog.Any("error", err))
+	}
+}
+
+// emitSlowQuery emits the event of the slow query as a log record with the warning severity, if there's
+// a log exporter.
+func (c *collector) emitSlowQuery(ctx context.Context, event slowQueryEvent) {
+	if c.slowQueryLogger == nil {
+		return
+	}
+
+	reasons := make([]log.Value, 0, len(event.Reasons))
+	for _, reason := range event.Reasons {
+		reasons = append(reasons, log.StringValue(reason))
+	}
+
+	var record log.Record
+	record.SetTimestamp(event.Time)
+	record.SetObservedTimestamp(time.Now().UTC())
+	record.SetSeverity(log.SeverityWarn)
+	record.SetSeverityText("WARN")
+	record.SetBody(log.StringValue(event.QueryText))
+
+	record.AddAttributes(
+		log.String("firebolt.account.name", event.Account),
+		log.String("firebolt.engine.name", event.Engine),
+		log.String("firebolt.user.name", event.User),
+		log.String("firebolt.query.id", event.QueryID),
+		log.String("firebolt.query.status", event.Status),
+		log.String("firebolt.query.type", event.Type),
+		log.String("firebolt.query.label", event.Label),
+		log.String("firebolt.query.fingerprint", event.Fingerprint),
+		log.Slice("firebolt.query.slow.reasons", reasons...),
+		log.Float64("firebolt.query.duration", event.Duration),
+		log.Float64("firebolt.query.queue.time", event.QueueTime),
+		log.Float64("firebolt.query.cpu.usage", event.CPUUsage),
+		log.Float64("firebolt.query.cpu.delay", event.CPUDelay),
+		log.Int64("firebolt.query.scanned.rows", event.ScannedRows),
+		log.Int64("firebolt.query.scanned.bytes", event.ScannedBytes),
+		log.Int64("firebolt.query.scanned.cache.bytes", event.ScannedCacheBytes),
+		log.Int64("firebolt.query.scanned.storage.bytes", event.ScannedStorageBytes),
+		log.Int64("firebolt.query.spilled.bytes", event.SpilledBytes),
+	)
+
+	if event.ErrorMessage != "" {
+		record.AddAttributes(log.String("firebolt.query.error.message", event.ErrorMessage))
+	}
+
+	c.slowQueryLogger.Emit(ctx, record)
+}
@@ -0,0 +1,240 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/firebolt-db/otel-exporter/internal/fetcher"
+	"github.com/firebolt-db/otel-exporter/internal/slowquery"
+)
+
+// slowQueryPoints returns the queries of the slow query tests: the first one exceeds the default duration
+// threshold, the second one only exceeds the threshold of its user, and the third one is not slow.
+func slowQueryPoints(submittedTime time.Time) []fetcher.QueryHistoryPoint {
+	return []fetcher.QueryHistoryPoint{
+		{
+			EngineName:           "engine1",
+			QueryID:              sql.NullString{Valid: true, String: "q1"},
+			SubmittedTime:        sql.Null[time.Time]{Valid: true, V: submittedTime},
+			UserName:             sql.NullString{Valid: true, String: "alice"},
+			Status:               sql.NullString{Valid: true, String: "ENDED_SUCCESSFULLY"},
+			QueryText:            sql.NullString{Valid: true, String: "SELECT * FROM users WHERE password = 'secret'"},
+			DurationMicroSeconds: sql.NullInt64{Valid: true, Int64: 90000000},
+			ScannedBytes:         sql.NullInt64{Valid: true, Int64: 2000},
+			CPUUsageMicroSeconds: sql.NullInt64{Valid: true, Int64: 1500000},
+		},
+		{
+			EngineName:              "engine1",
+			QueryID:                 sql.NullString{Valid: true, String: "q2"},
+			SubmittedTime:           sql.Null[time.Time]{Valid: true, V: submittedTime},
+			UserName:                sql.NullString{Valid: true, String: "dashboard"},
+			Status:                  sql.NullString{Valid: true, String: "ENDED_SUCCESSFULLY"},
+			QueryText:               sql.NullString{Valid: true, String: "SELECT 1"},
+			DurationMicroSeconds:    sql.NullInt64{Valid: true, Int64: 2000000},
+			TimeInQueueMicroSeconds: sql.NullInt64{Valid: true, Int64: 2000000},
+		},
+		{
+			EngineName:           "engine1",
+			QueryID:              sql.NullString{Valid: true, String: "q3"},
+			SubmittedTime:        sql.Null[time.Time]{Valid: true, V: submittedTime},
+			UserName:             sql.NullString{Valid: true, String: "alice"},
+			Status:               sql.NullString{Valid: true, String: "ENDED_SUCCESSFULLY"},
+			QueryText:            sql.NullString{Valid: true, String: "SELECT 2"},
+			DurationMicroSeconds: sql.NullInt64{Valid: true, Int64: 1000000},
+		},
+	}
+}
+
+// slowQueryRules returns the rules of the slow query tests.
+func slowQueryRules() slowquery.Rules {
+	return slowquery.Rules{
+		Default: slowquery.Thresholds{Duration: time.Minute, ScannedBytes: 1000},
+		Users:   map[string]slowquery.Thresholds{"dashboard": {QueueTime: time.Second}},
+		Redact:  []*regexp.Regexp{regexp.MustCompile(`'[^']*'`)},
+	}
+}
+
+func Test_Collector_collectQueryHistoryMetrics_slowQueries(t *testing.T) {
+	t.Parallel()
+
+	acctName := "acct"
+	till := time.Now().UTC()
+	since := till.Add(-time.Minute)
+	submittedTime := since.Add(time.Second)
+
+	out := &bytes.Buffer{}
+	f := newFetcherMock()
+	c, err := NewCollector(f, []string{acctName}, WithExporter(newExporterMock()),
+		WithSlowQueries(SlowQueries{Enabled: true, Rules: slowQueryRules(), Writer: out}),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+	col := c.(*collector)
+	f.fetchQueryHistoryPointsFn = func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) (<-chan fetcher.QueryHistoryPoint, <-chan error) {
+		points := slowQueryPoints(submittedTime)
+		ch := make(chan fetcher.QueryHistoryPoint, len(points))
+		for _, point := range points {
+			ch <- point
+		}
+		close(ch)
+
+		return ch, closedErrCh()
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	col.collectQueryHistoryMetrics(context.Background(), wg, acctName, []fetcher.Engine{{Name: "engine1", Status: "RUNNING"}}, since, till)
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var first slowQueryEvent
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+	require.Equal(t, slowQueryEvent{
+		Time:         submittedTime,
+		Account:      acctName,
+		Engine:       "engine1",
+		User:         "alice",
+		QueryID:      "q1",
+		Status:       "ENDED_SUCCESSFULLY",
+		Type:         "SELECT",
+		Fingerprint:  queryFingerprint("SELECT * FROM users WHERE password = 'secret'"),
+		Reasons:      []string{slowquery.ReasonDuration, slowquery.ReasonScannedBytes},
+		Duration:     90,
+		CPUUsage:     1.5,
+		ScannedBytes: 2000,
+		QueryText:    "SELECT * FROM users WHERE password = ?",
+	}, first)
+
+	var second slowQueryEvent
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &second))
+	require.Equal(t, "q2", second.QueryID)
+	require.Equal(t, []string{slowquery.ReasonQueueTime}, second.Reasons)
+
+	sm, err := col.producer.Produce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, sm, 1)
+
+	counts := make(map[string]int64)
+	for _, m := range sm[0].Metrics {
+		if m.Name != "firebolt.query.slow.count" {
+			continue
+		}
+
+		for _, point := range m.Data.(metricdata.Sum[int64]).DataPoints {
+			user, _ := point.Attributes.Value("firebolt.user.name")
+			counts[user.AsString()] = point.Value
+		}
+	}
+	require.Equal(t, map[string]int64{"alice": 1, "dashboard": 1}, counts)
+}
+
+func Test_Collector_collectQueryHistoryMetrics_slowQueryLogs(t *testing.T) {
+	t.Parallel()
+
+	acctName := "acct"
+	till := time.Now().UTC()
+	since := till.Add(-time.Minute)
+	submittedTime := since.Add(time.Second)
+
+	f := newFetcherMock()
+	logExp := &logExporterMock{}
+	c, err := NewCollector(f, []string{acctName}, WithExporter(newExporterMock()),
+		WithLogExporter(logExp),
+		WithSlowQueries(SlowQueries{Enabled: true, Rules: slowQueryRules()}),
+	)
+	require.NoError(t, err)
+
+	col := c.(*collector)
+	f.fetchQueryHistoryPointsFn = func(ctx context.Context, account string, engines []fetcher.Engine, since, till time.Time) (<-chan fetcher.QueryHistoryPoint, <-chan error) {
+		ch := make(chan fetcher.QueryHistoryPoint, 1)
+		ch <- slowQueryPoints(submittedTime)[0]
+		close(ch)
+
+		return ch, closedErrCh()
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	col.collectQueryHistoryMetrics(context.Background(), wg, acctName, []fetcher.Engine{{Name: "engine1", Status: "RUNNING"}}, since, till)
+	wg.Wait()
+
+	// the log records are exported once the collector is closed
+	require.NoError(t, c.Close(context.Background()))
+
+	// only the slow query is emitted, since the query logs are disabled.
+	records := logExp.exported()
+	require.Len(t, records, 1)
+
+	record := records[0]
+	require.Equal(t, submittedTime, record.Timestamp())
+	require.Equal(t, log.SeverityWarn, record.Severity())
+	require.Equal(t, "SELECT * FROM users WHERE password = ?", record.Body().AsString())
+
+	attrs := make(map[string]log.Value)
+	record.WalkAttributes(func(kv log.KeyValue) bool {
+		attrs[kv.Key] = kv.Value
+		return true
+	})
+	require.Equal(t, "q1", attrs["firebolt.query.id"].AsString())
+	require.Equal(t, 90.0, attrs["firebolt.query.duration"].AsFloat64())
+	require.Equal(t, []log.Value{log.StringValue("duration"), log.StringValue("scanned_bytes")},
+		attrs["firebolt.query.slow.reasons"].AsSlice())
+}
+
+func Test_Collector_forgetStaleSeries_slowQueries(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewCollector(newFetcherMock(), []string{"acct"}, WithExporter(newExporterMock()),
+		WithSlowQueries(SlowQueries{Enabled: true, Rules: slowQueryRules(), Writer: &bytes.Buffer{}}),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, c.Close(context.Background())) })
+
+	col := c.(*collector)
+	till := time.Now().UTC()
+	for _, mp := range slowQueryPoints(till.Add(-time.Second)) {
+		col.reportSlowQuery(context.Background(), "acct", till, mp)
+	}
+
+	slowQueries := func() int64 {
+		sm, err := col.producer.Produce(context.Background())
+		require.NoError(t, err)
+
+		var total int64
+		for _, scope := range sm {
+			for _, m := range scope.Metrics {
+				if m.Name != "firebolt.query.slow.count" {
+					continue
+				}
+
+				for _, point := range m.Data.(metricdata.Sum[int64]).DataPoints {
+					total += point.Value
+				}
+			}
+		}
+		return total
+	}
+
+	// the series have no status, so they are kept while the engine is running
+	col.forgetStaleSeries("acct", []fetcher.Engine{{Name: "engine1", Status: "RUNNING"}})
+	require.Equal(t, int64(2), slowQueries())
+	require.Equal(t, int64(2), slowQueries())
+
+	// and dropped once the engine stops
+	col.forgetStaleSeries("acct", nil)
+	require.Equal(t, int64(0), slowQueries())
+}
@@ -0,0 +1,61 @@
+package collector
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// statementType returns the type of the statement of the query, such as SELECT, INSERT or DDL, which is reported
+// as the attribute of the query history metrics. The type is told by the leading keyword of the query text, so that
+// the queries, which are not parsed by the MySQL grammar of sqlparser, are still classified.
+func statementType(queryText string) string {
+	switch sqlparser.Preview(queryText) {
+	case sqlparser.StmtSelect, sqlparser.StmtStream:
+		return "SELECT"
+	case sqlparser.StmtInsert, sqlparser.StmtReplace:
+		return "INSERT"
+	case sqlparser.StmtUpdate:
+		return "UPDATE"
+	case sqlparser.StmtDelete:
+		return "DELETE"
+	case sqlparser.StmtDDL:
+		return "DDL"
+	case sqlparser.StmtBegin, sqlparser.StmtCommit, sqlparser.StmtRollback:
+		return "TRANSACTION"
+	case sqlparser.StmtSet:
+		return "SET"
+	case sqlparser.StmtShow:
+		return "SHOW"
+	case sqlparser.StmtUse:
+		return "USE"
+	}
+
+	// the statements specific to Firebolt are not known by sqlparser.
+	switch strings.ToLower(firstWord(queryText)) {
+	case "":
+		return "UNKNOWN"
+	case "copy":
+		return "COPY"
+	case "with":
+		return "SELECT"
+	case "vacuum":
+		return "VACUUM"
+	default:
+		return "OTHER"
+	}
+}
+
+// firstWord returns the leading keyword of the query text, skipping the comments and the opening parentheses.
+func firstWord(queryText string) string {
+	trimmed := strings.TrimLeftFunc(sqlparser.StripLeadingComments(queryText), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	if end := strings.IndexFunc(trimmed, func(r rune) bool { return !unicode.IsLetter(r) }); end != -1 {
+		return trimmed[:end]
+	}
+
+	return trimmed
+}
@@ -0,0 +1,37 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_statementType(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"SELECT * FROM orders": "SELECT",
+		"  select 1":           "SELECT",
+		"/* dashboard */ SELECT count(*) FROM orders":                "SELECT",
+		"(SELECT 1) UNION ALL (SELECT 2)":                            "SELECT",
+		"WITH recent AS (SELECT * FROM orders) SELECT * FROM recent": "SELECT",
+		"INSERT INTO orders SELECT * FROM staging":                   "INSERT",
+		"UPDATE orders SET status = 'shipped'":                       "UPDATE",
+		"DELETE FROM orders WHERE id = 1":                            "DELETE",
+		"CREATE TABLE orders (id INT)":                               "DDL",
+		"DROP TABLE orders":                                          "DDL",
+		"COPY INTO orders FROM 's3://bucket/orders/'":                "COPY",
+		"-- nightly load\nCOPY orders FROM 's3://bucket/'":           "COPY",
+		"BEGIN":                "TRANSACTION",
+		"SET query_label=dbt;": "SET",
+		"SHOW TABLES":          "SHOW",
+		"USE ENGINE my_engine": "USE",
+		"VACUUM orders":        "VACUUM",
+		"EXPLAIN SELECT 1":     "OTHER",
+		"":                     "UNKNOWN",
+	}
+
+	for queryText, expected := range tests {
+		require.Equal(t, expected, statementType(queryText), queryText)
+	}
+}
@@ -2,16 +2,28 @@ package config
 
 import (
 	"context"
+	"errors"
+	"regexp"
 	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/sethvargo/go-envconfig"
 
+	"github.com/firebolt-db/otel-exporter/internal/collector"
 	"github.com/firebolt-db/otel-exporter/internal/exporter/grpcexporter"
 	"github.com/firebolt-db/otel-exporter/internal/exporter/httpexporter"
 	"github.com/firebolt-db/otel-exporter/internal/logging"
 )
 
+var (
+	// queryLabelRegexp matches the allowed query labels.
+	queryLabelRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+	// connectionValueRegexp matches the values, which can be passed in the connection string of Firebolt driver.
+	// The driver doesn't decode the connection string, so '=' and '&' can't be escaped.
+	connectionValueRegexp = regexp.MustCompile(`^[^=&]+$`)
+)
+
 // Config defines app configuration. It is expected that all the values in configuration are provided via
 // environment variables.
 type Config struct {
@@ -31,6 +43,76 @@ type Config struct {
 	// CollectInterval specifies how often otel-exporter will collect metrics from Firebolt. It will also define
 	// a discretion step of reported metrics.
 	CollectInterval time.Duration `env:"FIREBOLT_OTEL_EXPORTER_COLLECT_INTERVAL,default=30s"`
+
+	// Runtime specifies the schedule of the engine runtime metrics.
+	Runtime SourceConfig `env:",prefix=FIREBOLT_OTEL_EXPORTER_RUNTIME_"`
+
+	// QueryHistory specifies the schedule of the query history metrics.
+	QueryHistory SourceConfig `env:",prefix=FIREBOLT_OTEL_EXPORTER_QUERY_HISTORY_"`
+
+	// QueryHistoryLookback specifies how far behind the collection window query history is read again, so that
+	// queries which finish after the window they were submitted in are still reported. Queries are reported once.
+	QueryHistoryLookback time.Duration `env:"FIREBOLT_OTEL_EXPORTER_QUERY_HISTORY_LOOKBACK,default=10m"`
+
+	// StateFile specifies a path of the file, where the query history collection progress is kept, so that the
+	// collection is resumed after a restart. If it's not set, the progress is kept in memory only.
+	StateFile string `env:"FIREBOLT_OTEL_EXPORTER_STATE_FILE"`
+
+	// MaxCatchUp specifies how far back the query history collection of an engine can be resumed after a restart.
+	MaxCatchUp time.Duration `env:"FIREBOLT_OTEL_EXPORTER_MAX_CATCH_UP,default=1h"`
+
+	// RuntimeAllSamples specifies whether all the engine runtime samples within the collection window are reported,
+	// along with their minimum, maximum and average. Otherwise, only the most recent sample is reported.
+	RuntimeAllSamples bool `env:"FIREBOLT_OTEL_EXPORTER_RUNTIME_ALL_SAMPLES,default=false"`
+
+	// QueryLabel specifies the query label of the exporter's queries, used to tell them apart in query history.
+	QueryLabel string `env:"FIREBOLT_OTEL_EXPORTER_QUERY_LABEL,default=otel-exporter"`
+
+	// IncludeExporterQueries specifies whether the exporter's own queries are included in the query history metrics.
+	// They are reported in the exporter's own metrics either way.
+	IncludeExporterQueries bool `env:"FIREBOLT_OTEL_EXPORTER_INCLUDE_EXPORTER_QUERIES,default=false"`
+
+	// EngineTimeout specifies how long the metrics of a single engine are fetched, before the engine is considered
+	// timed out. Engines which timed out resume from their watermark on the next cycle.
+	EngineTimeout time.Duration `env:"FIREBOLT_OTEL_EXPORTER_ENGINE_TIMEOUT,default=1m"`
+
+	// CycleTimeout specifies how long a single collection cycle of all the accounts runs, before it's cut short.
+	CycleTimeout time.Duration `env:"FIREBOLT_OTEL_EXPORTER_CYCLE_TIMEOUT,default=2m"`
+
+	// AccountConcurrency specifies how many accounts are collected at once.
+	AccountConcurrency int `env:"FIREBOLT_OTEL_EXPORTER_ACCOUNT_CONCURRENCY,default=4"`
+
+	// MaxConnections specifies how many queries are run in Firebolt at once, across all the accounts and engines.
+	MaxConnections int `env:"FIREBOLT_OTEL_EXPORTER_MAX_CONNECTIONS,default=16"`
+
+	// OverrunPolicy specifies how the collection proceeds, when a cycle runs past the start of the next one:
+	// the missed windows are either skipped, collected one by one, or merged into a single one.
+	OverrunPolicy collector.OverrunPolicy `env:"FIREBOLT_OTEL_EXPORTER_OVERRUN_POLICY,default=merge"`
+
+	// ServerTime specifies whether the collection windows are based on the time of Firebolt, which is read from
+	// the system engine at the start of each cycle, rather than the local clock.
+	ServerTime bool `env:"FIREBOLT_OTEL_EXPORTER_SERVER_TIME,default=false"`
+
+	// ErrorRulesFile specifies a path of the YAML file with the rules, which assign the fingerprints to the error
+	// messages of the failed queries. The rules are applied before the default ones.
+	ErrorRulesFile string `env:"FIREBOLT_OTEL_EXPORTER_ERROR_RULES_FILE"`
+
+	// QueryLabels specifies how the query labels are reported as the attribute of the query history metrics.
+	QueryLabels QueryLabelsConfig `env:",prefix=FIREBOLT_OTEL_EXPORTER_QUERY_LABELS_"`
+
+	// QueryFingerprintsTopK specifies how many of the heaviest query fingerprints of each engine are reported
+	// in each cycle. Zero, which is the default, disables the query fingerprint metrics.
+	QueryFingerprintsTopK int `env:"FIREBOLT_OTEL_EXPORTER_QUERY_FINGERPRINTS_TOP_K,default=0"`
+
+	// QueryLogs specifies how the queries of the query history are emitted as log records.
+	QueryLogs QueryLogsConfig `env:",prefix=FIREBOLT_OTEL_EXPORTER_QUERY_LOGS_"`
+
+	// QuerySpans specifies whether the queries of the query history are emitted as trace spans. The spans are
+	// exported with the same settings as the metrics.
+	QuerySpans bool `env:"FIREBOLT_OTEL_EXPORTER_QUERY_SPANS_ENABLED,default=false"`
+
+	// SlowQueries specifies which queries of the query history are slow, and how they are reported.
+	SlowQueries SlowQueriesConfig `env:",prefix=FIREBOLT_OTEL_EXPORTER_SLOW_QUERIES_"`
 }
 
 // Validate validates Config
@@ -38,14 +120,160 @@ func (c Config) Validate() error {
 	return validation.ValidateStruct(
 		&c,
 		validation.Field(&c.Logging),
-		validation.Field(&c.Accounts, validation.Required),
+		validation.Field(&c.Accounts, validation.Required, validation.Each(validation.Match(connectionValueRegexp))),
 		validation.Field(&c.Credentials),
 		validation.Field(&c.Exporter),
 		// Minimal allowed collect interval is 15s.
 		validation.Field(&c.CollectInterval, validation.Required, validation.Min(15*time.Second)),
+		validation.Field(&c.Runtime),
+		// At least one source of the metrics must be collected.
+		validation.Field(&c.QueryHistory, validation.When(!c.Runtime.Enabled, validation.By(requireEnabled))),
+		validation.Field(&c.QueryHistoryLookback, validation.Min(time.Duration(0))),
+		// Catch-up period shorter than collect interval would not let the collection make any progress.
+		validation.Field(&c.MaxCatchUp, validation.Required, validation.Min(c.CollectInterval),
+			validation.Min(c.Runtime.Interval), validation.Min(c.QueryHistory.Interval),
+		),
+		validation.Field(&c.QueryLabel, validation.Required, validation.Match(queryLabelRegexp)),
+		validation.Field(&c.EngineTimeout, validation.Required, validation.Min(time.Second)),
+		// Cycle timeout shorter than engine timeout would cut the engine timeout short.
+		validation.Field(&c.CycleTimeout, validation.Required, validation.Min(c.EngineTimeout)),
+		validation.Field(&c.AccountConcurrency, validation.Required, validation.Min(1)),
+		validation.Field(&c.MaxConnections, validation.Required, validation.Min(1)),
+		validation.Field(&c.QueryLabels),
+		validation.Field(&c.QueryFingerprintsTopK, validation.Min(0)),
+		validation.Field(&c.QueryLogs),
+		validation.Field(&c.SlowQueries),
+		validation.Field(
+			&c.OverrunPolicy,
+			validation.Required,
+			validation.In(collector.OverrunSkip, collector.OverrunCatchUp, collector.OverrunMerge),
+		),
+	)
+}
+
+// SourceConfig specifies the schedule of a single source of the metrics.
+type SourceConfig struct {
+	// Enabled specifies whether the source is collected at all.
+	Enabled bool `env:"ENABLED,default=true"`
+
+	// Interval specifies how often the source is collected. If it's not set, CollectInterval is used.
+	Interval time.Duration `env:"INTERVAL"`
+
+	// Offset specifies how long the collection of each window is delayed, so that its data has time to land in Firebolt.
+	Offset time.Duration `env:"OFFSET,default=0s"`
+}
+
+// Validate validates SourceConfig.
+func (c SourceConfig) Validate() error {
+	return validation.ValidateStruct(
+		&c,
+		// Minimal allowed interval is 15s, the same as of the collect interval.
+		validation.Field(&c.Interval, validation.When(c.Interval != 0, validation.Min(15*time.Second))),
+		validation.Field(&c.Offset, validation.Min(time.Duration(0))),
+	)
+}
+
+// QueryLabelsConfig specifies how the query labels are reported as the attribute of the query history metrics.
+type QueryLabelsConfig struct {
+	// Enabled specifies whether the query labels are reported at all.
+	Enabled bool `env:"ENABLED,default=false"`
+
+	// Allow specifies the labels, which are reported. Other labels are reported as other, unless they match Pattern.
+	Allow []string `env:"ALLOW"`
+
+	// Pattern specifies a regular expression, which matches the labels reported.
+	Pattern string `env:"PATTERN"`
+
+	// Limit specifies how many distinct labels are reported in each cycle at most, so that the number of series stays
+	// bounded. The labels with the most queries in the previous cycle are reported.
+	Limit int `env:"LIMIT,default=50"`
+}
+
+// Validate validates QueryLabelsConfig.
+func (c QueryLabelsConfig) Validate() error {
+	return validation.ValidateStruct(
+		&c,
+		validation.Field(&c.Pattern, validation.By(isRegexp)),
+		validation.Field(&c.Limit, validation.Min(0)),
+	)
+}
+
+// QueryLogsConfig specifies how the queries of the query history are emitted as log records. The log records are
+// exported with the same settings as the metrics.
+type QueryLogsConfig struct {
+	// Enabled specifies whether the queries are emitted as log records at all.
+	Enabled bool `env:"ENABLED,default=false"`
+
+	// QueryTextLength specifies how many characters of the query text are included in the log record at most.
+	// Zero means that the query text is not included.
+	QueryTextLength int `env:"QUERY_TEXT_LENGTH,default=1024"`
+
+	// Redact specifies whether the literals of the query text and the error message are replaced by `?`. The error
+	// messages of the query spans are redacted the same way.
+	Redact bool `env:"REDACT,default=true"`
+}
+
+// Validate validates QueryLogsConfig.
+func (c QueryLogsConfig) Validate() error {
+	return validation.ValidateStruct(
+		&c,
+		validation.Field(&c.QueryTextLength, validation.Min(0)),
 	)
 }
 
+// Outputs of the slow query events.
+const (
+	// SlowQueriesOutputLog emits the events as log records, which are exported with the same settings as the metrics.
+	SlowQueriesOutputLog = "log"
+	// SlowQueriesOutputStdout writes the events to the standard output as JSON lines.
+	SlowQueriesOutputStdout = "stdout"
+)
+
+// SlowQueriesConfig specifies which queries of the query history are slow, and how they are reported.
+type SlowQueriesConfig struct {
+	// Enabled specifies whether the slow queries are reported at all.
+	Enabled bool `env:"ENABLED,default=false"`
+
+	// Duration, QueueTime and ScannedBytes are the default thresholds of the queries. Zero disables the threshold.
+	Duration     time.Duration `env:"DURATION,default=1m"`
+	QueueTime    time.Duration `env:"QUEUE_TIME,default=0s"`
+	ScannedBytes int64         `env:"SCANNED_BYTES,default=0"`
+
+	// RulesFile specifies a path of the YAML file with the thresholds of the engines and users, and the patterns,
+	// which are redacted from the query texts.
+	RulesFile string `env:"RULES_FILE"`
+
+	// Output specifies where the events of the slow queries are reported to.
+	Output string `env:"OUTPUT,default=log"`
+}
+
+// Validate validates SlowQueriesConfig.
+func (c SlowQueriesConfig) Validate() error {
+	return validation.ValidateStruct(
+		&c,
+		validation.Field(&c.Duration, validation.Min(time.Duration(0))),
+		validation.Field(&c.QueueTime, validation.Min(time.Duration(0))),
+		validation.Field(&c.ScannedBytes, validation.Min(int64(0))),
+		validation.Field(&c.Output, validation.Required, validation.In(SlowQueriesOutputLog, SlowQueriesOutputStdout)),
+	)
+}
+
+// isRegexp ensures that the value is a valid regular expression.
+func isRegexp(value any) error {
+	if _, err := regexp.Compile(value.(string)); err != nil {
+		return errors.New("must be a valid regular expression")
+	}
+	return nil
+}
+
+// requireEnabled ensures that the source is enabled.
+func requireEnabled(value any) error {
+	if !value.(SourceConfig).Enabled {
+		return errors.New("must be enabled when the runtime metrics are disabled")
+	}
+	return nil
+}
+
 // Credentials specifies Firebolt Service Account credentials, used to run queries.
 type Credentials struct {
 	// ClientID is client_id of the Firebolt Service Account
@@ -59,8 +287,8 @@ type Credentials struct {
 func (c Credentials) Validate() error {
 	return validation.ValidateStruct(
 		&c,
-		validation.Field(&c.ClientID, validation.Required),
-		validation.Field(&c.ClientSecret, validation.Required),
+		validation.Field(&c.ClientID, validation.Required, validation.Match(connectionValueRegexp)),
+		validation.Field(&c.ClientSecret, validation.Required, validation.Match(connectionValueRegexp)),
 	)
 }
 
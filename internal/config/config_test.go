@@ -9,6 +9,7 @@ import (
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/firebolt-db/otel-exporter/internal/collector"
 	"github.com/firebolt-db/otel-exporter/internal/config"
 	"github.com/firebolt-db/otel-exporter/internal/exporter/grpcexporter"
 	"github.com/firebolt-db/otel-exporter/internal/exporter/httpexporter"
@@ -44,7 +45,28 @@ func Test_Config(t *testing.T) {
 				Address: "grpc_address",
 			},
 		},
-		CollectInterval: 30 * time.Second,
+		CollectInterval:      30 * time.Second,
+		Runtime:              config.SourceConfig{Enabled: true},
+		QueryHistory:         config.SourceConfig{Enabled: true},
+		QueryHistoryLookback: 10 * time.Minute,
+		MaxCatchUp:           time.Hour,
+		QueryLabel:           "otel-exporter",
+		EngineTimeout:        time.Minute,
+		CycleTimeout:         2 * time.Minute,
+		AccountConcurrency:   4,
+		MaxConnections:       16,
+		OverrunPolicy:        collector.OverrunMerge,
+		QueryLabels: config.QueryLabelsConfig{
+			Limit: 50,
+		},
+		QueryLogs: config.QueryLogsConfig{
+			QueryTextLength: 1024,
+			Redact:          true,
+		},
+		SlowQueries: config.SlowQueriesConfig{
+			Duration: time.Minute,
+			Output:   config.SlowQueriesOutputLog,
+		},
 	}, cfg)
 }
 
@@ -61,6 +83,112 @@ func Test_Config_MissingCreds(t *testing.T) {
 	require.Nil(t, cfg)
 }
 
+func Test_Config_InvalidQueryLabel(t *testing.T) {
+	os.Clearenv()
+
+	require.NoError(t, errors.Join(
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_ACCOUNTS", "acc1"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_CLIENT_ID", "client_id"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_CLIENT_SECRET", "client_secret"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_GRPC_ADDRESS", "grpc_address"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_QUERY_LABEL", "otel exporter;"),
+	))
+
+	cfg, err := config.NewConfig(context.Background())
+	require.ErrorContains(t, err, "QueryLabel: must be in a valid format")
+	require.Nil(t, cfg)
+}
+
+func Test_Config_InvalidConnectionValues(t *testing.T) {
+	os.Clearenv()
+
+	require.NoError(t, errors.Join(
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_ACCOUNTS", "acc1,acc2&engine=other"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_CLIENT_ID", "client_id"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_CLIENT_SECRET", "client=secret"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_GRPC_ADDRESS", "grpc_address"),
+	))
+
+	cfg, err := config.NewConfig(context.Background())
+	require.ErrorContains(t, err, "Accounts: (1: must be in a valid format.)")
+	require.ErrorContains(t, err, "ClientSecret: must be in a valid format")
+	require.Nil(t, cfg)
+}
+
+func Test_Config_CycleTimeoutShorterThanEngineTimeout(t *testing.T) {
+	os.Clearenv()
+
+	require.NoError(t, errors.Join(
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_ACCOUNTS", "acc1"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_CLIENT_ID", "client_id"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_CLIENT_SECRET", "client_secret"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_GRPC_ADDRESS", "grpc_address"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_ENGINE_TIMEOUT", "2m"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_CYCLE_TIMEOUT", "1m"),
+	))
+
+	cfg, err := config.NewConfig(context.Background())
+	require.ErrorContains(t, err, "CycleTimeout: must be no less than 2m0s")
+	require.Nil(t, cfg)
+}
+
+func Test_Config_InvalidSources(t *testing.T) {
+	os.Clearenv()
+
+	require.NoError(t, errors.Join(
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_ACCOUNTS", "acc1"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_CLIENT_ID", "client_id"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_CLIENT_SECRET", "client_secret"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_GRPC_ADDRESS", "grpc_address"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_RUNTIME_ENABLED", "false"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_RUNTIME_INTERVAL", "5s"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_QUERY_HISTORY_ENABLED", "false"),
+	))
+
+	cfg, err := config.NewConfig(context.Background())
+	require.ErrorContains(t, err, "Runtime: (Interval: must be no less than 15s.)")
+	require.ErrorContains(t, err, "QueryHistory: must be enabled when the runtime metrics are disabled")
+	require.Nil(t, cfg)
+}
+
+func Test_Config_InvalidQueryLabels(t *testing.T) {
+	os.Clearenv()
+
+	require.NoError(t, errors.Join(
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_ACCOUNTS", "acc1"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_CLIENT_ID", "client_id"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_CLIENT_SECRET", "client_secret"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_GRPC_ADDRESS", "grpc_address"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_QUERY_LABELS_PATTERN", "(dbt"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_QUERY_LABELS_LIMIT", "-1"),
+	))
+
+	cfg, err := config.NewConfig(context.Background())
+	require.ErrorContains(t, err, "Limit: must be no less than 0")
+	require.ErrorContains(t, err, "Pattern: must be a valid regular expression")
+	require.Nil(t, cfg)
+}
+
+func Test_Config_InvalidSlowQueries(t *testing.T) {
+	os.Clearenv()
+
+	require.NoError(t, errors.Join(
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_ACCOUNTS", "acc1"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_CLIENT_ID", "client_id"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_CLIENT_SECRET", "client_secret"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_GRPC_ADDRESS", "grpc_address"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_SLOW_QUERIES_DURATION", "-1s"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_SLOW_QUERIES_SCANNED_BYTES", "-1"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_SLOW_QUERIES_OUTPUT", "file"),
+	))
+
+	cfg, err := config.NewConfig(context.Background())
+	require.ErrorContains(t, err, "Duration: must be no less than 0")
+	require.ErrorContains(t, err, "ScannedBytes: must be no less than 0")
+	require.ErrorContains(t, err, "Output: must be a valid value")
+	require.Nil(t, cfg)
+}
+
 func Test_Config_OverrideDefaults(t *testing.T) {
 	os.Clearenv()
 
@@ -68,6 +196,37 @@ func Test_Config_OverrideDefaults(t *testing.T) {
 		os.Setenv("FIREBOLT_OTEL_EXPORTER_LOG_FORMAT", "text"),
 		os.Setenv("FIREBOLT_OTEL_EXPORTER_LOG_LEVEL", "debug"),
 		os.Setenv("FIREBOLT_OTEL_EXPORTER_COLLECT_INTERVAL", "1m"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_RUNTIME_INTERVAL", "15s"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_QUERY_HISTORY_INTERVAL", "2m"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_QUERY_HISTORY_OFFSET", "30s"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_QUERY_HISTORY_LOOKBACK", "1h"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_STATE_FILE", "/var/lib/otel-exporter/state.json"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_MAX_CATCH_UP", "6h"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_RUNTIME_ALL_SAMPLES", "true"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_QUERY_LABEL", "otel-exporter-prod"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_INCLUDE_EXPORTER_QUERIES", "true"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_ENGINE_TIMEOUT", "30s"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_CYCLE_TIMEOUT", "5m"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_ACCOUNT_CONCURRENCY", "8"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_MAX_CONNECTIONS", "32"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_OVERRUN_POLICY", "catchup"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_SERVER_TIME", "true"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_ERROR_RULES_FILE", "/etc/otel-exporter/error-rules.yaml"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_QUERY_LABELS_ENABLED", "true"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_QUERY_LABELS_ALLOW", "dbt,looker"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_QUERY_LABELS_PATTERN", "^etl-"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_QUERY_LABELS_LIMIT", "10"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_QUERY_FINGERPRINTS_TOP_K", "5"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_QUERY_LOGS_ENABLED", "true"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_QUERY_LOGS_QUERY_TEXT_LENGTH", "0"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_QUERY_LOGS_REDACT", "false"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_QUERY_SPANS_ENABLED", "true"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_SLOW_QUERIES_ENABLED", "true"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_SLOW_QUERIES_DURATION", "30s"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_SLOW_QUERIES_QUEUE_TIME", "5s"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_SLOW_QUERIES_SCANNED_BYTES", "1000000000"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_SLOW_QUERIES_RULES_FILE", "/etc/otel-exporter/slow-queries.yaml"),
+		os.Setenv("FIREBOLT_OTEL_EXPORTER_SLOW_QUERIES_OUTPUT", "stdout"),
 
 		os.Setenv("FIREBOLT_OTEL_EXPORTER_ACCOUNTS", "acc1,acc2"),
 		os.Setenv("FIREBOLT_OTEL_EXPORTER_CLIENT_ID", "client_id"),
@@ -94,6 +253,47 @@ func Test_Config_OverrideDefaults(t *testing.T) {
 			},
 		},
 		CollectInterval: 60 * time.Second,
+		Runtime: config.SourceConfig{
+			Enabled:  true,
+			Interval: 15 * time.Second,
+		},
+		QueryHistory: config.SourceConfig{
+			Enabled:  true,
+			Interval: 2 * time.Minute,
+			Offset:   30 * time.Second,
+		},
+		QueryHistoryLookback:   time.Hour,
+		StateFile:              "/var/lib/otel-exporter/state.json",
+		MaxCatchUp:             6 * time.Hour,
+		RuntimeAllSamples:      true,
+		QueryLabel:             "otel-exporter-prod",
+		IncludeExporterQueries: true,
+		EngineTimeout:          30 * time.Second,
+		CycleTimeout:           5 * time.Minute,
+		AccountConcurrency:     8,
+		MaxConnections:         32,
+		OverrunPolicy:          collector.OverrunCatchUp,
+		ServerTime:             true,
+		ErrorRulesFile:         "/etc/otel-exporter/error-rules.yaml",
+		QueryLabels: config.QueryLabelsConfig{
+			Enabled: true,
+			Allow:   []string{"dbt", "looker"},
+			Pattern: "^etl-",
+			Limit:   10,
+		},
+		QueryFingerprintsTopK: 5,
+		QueryLogs: config.QueryLogsConfig{
+			Enabled: true,
+		},
+		QuerySpans: true,
+		SlowQueries: config.SlowQueriesConfig{
+			Enabled:      true,
+			Duration:     30 * time.Second,
+			QueueTime:    5 * time.Second,
+			ScannedBytes: 1000000000,
+			RulesFile:    "/etc/otel-exporter/slow-queries.yaml",
+			Output:       config.SlowQueriesOutputStdout,
+		},
 	}, cfg)
 }
 
@@ -144,7 +344,28 @@ func Test_Config_GRPC(t *testing.T) {
 				},
 			},
 		},
-		CollectInterval: 30 * time.Second,
+		CollectInterval:      30 * time.Second,
+		Runtime:              config.SourceConfig{Enabled: true},
+		QueryHistory:         config.SourceConfig{Enabled: true},
+		QueryHistoryLookback: 10 * time.Minute,
+		MaxCatchUp:           time.Hour,
+		QueryLabel:           "otel-exporter",
+		EngineTimeout:        time.Minute,
+		CycleTimeout:         2 * time.Minute,
+		AccountConcurrency:   4,
+		MaxConnections:       16,
+		OverrunPolicy:        collector.OverrunMerge,
+		QueryLabels: config.QueryLabelsConfig{
+			Limit: 50,
+		},
+		QueryLogs: config.QueryLogsConfig{
+			QueryTextLength: 1024,
+			Redact:          true,
+		},
+		SlowQueries: config.SlowQueriesConfig{
+			Duration: time.Minute,
+			Output:   config.SlowQueriesOutputLog,
+		},
 	}, cfg)
 }
 
@@ -186,6 +407,27 @@ func Test_Config_HTTP(t *testing.T) {
 				},
 			},
 		},
-		CollectInterval: 30 * time.Second,
+		CollectInterval:      30 * time.Second,
+		Runtime:              config.SourceConfig{Enabled: true},
+		QueryHistory:         config.SourceConfig{Enabled: true},
+		QueryHistoryLookback: 10 * time.Minute,
+		MaxCatchUp:           time.Hour,
+		QueryLabel:           "otel-exporter",
+		EngineTimeout:        time.Minute,
+		CycleTimeout:         2 * time.Minute,
+		AccountConcurrency:   4,
+		MaxConnections:       16,
+		OverrunPolicy:        collector.OverrunMerge,
+		QueryLabels: config.QueryLabelsConfig{
+			Limit: 50,
+		},
+		QueryLogs: config.QueryLogsConfig{
+			QueryTextLength: 1024,
+			Redact:          true,
+		},
+		SlowQueries: config.SlowQueriesConfig{
+			Duration: time.Minute,
+			Output:   config.SlowQueriesOutputLog,
+		},
 	}, cfg)
 }
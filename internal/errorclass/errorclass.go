@@ -0,0 +1,104 @@
+// Package errorclass normalizes the error messages of failed queries into a bounded set of fingerprints,
+// which can be reported as metric attributes.
+package errorclass
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Other is the fingerprint of the error messages, which match none of the rules.
+const Other = "other"
+
+// fingerprintRegexp matches the valid fingerprints, so that they make readable attribute values.
+var fingerprintRegexp = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// Rule assigns the fingerprint to the error messages, which match the pattern.
+type Rule struct {
+	Fingerprint string
+	Pattern     *regexp.Regexp
+}
+
+// DefaultRules returns the rules of the common errors, which are applied after the configured ones.
+func DefaultRules() []Rule {
+	return []Rule{
+		{Fingerprint: "out_of_memory", Pattern: regexp.MustCompile(`(?i)out of memory|memory limit|\bOOM\b`)},
+		{Fingerprint: "timeout", Pattern: regexp.MustCompile(`(?i)time(d)? ?out|deadline exceeded`)},
+		{Fingerprint: "permission_denied", Pattern: regexp.MustCompile(`(?i)permission denied|access denied|not authorized|insufficient privileges`)},
+		{Fingerprint: "syntax_error", Pattern: regexp.MustCompile(`(?i)syntax error|parse error|unexpected token`)},
+		{Fingerprint: "not_found", Pattern: regexp.MustCompile(`(?i)does not exist|not found|unknown (table|column|function)`)},
+		{Fingerprint: "canceled", Pattern: regexp.MustCompile(`(?i)cancel(l)?ed`)},
+	}
+}
+
+// Classifier assigns the fingerprints to the error messages.
+type Classifier struct {
+	rules []Rule
+}
+
+// NewClassifier creates a new Classifier, which applies provided rules in order, so that the first matching rule
+// assigns the fingerprint.
+func NewClassifier(rules ...Rule) *Classifier {
+	return &Classifier{rules: rules}
+}
+
+// Classify returns the fingerprint of the error message. Messages, which match none of the rules, are reported
+// as Other, so that the number of fingerprints is bounded by the number of rules.
+func (c *Classifier) Classify(message string) string {
+	for _, rule := range c.rules {
+		if rule.Pattern.MatchString(message) {
+			return rule.Fingerprint
+		}
+	}
+
+	return Other
+}
+
+// rulesFile is a YAML representation of the rules.
+type rulesFile struct {
+	Rules []struct {
+		Fingerprint string `yaml:"fingerprint"`
+		Pattern     string `yaml:"pattern"`
+	} `yaml:"rules"`
+}
+
+// LoadRules reads the rules from the YAML file at provided path. The file is expected to have a list of rules,
+// each having a fingerprint and a regular expression pattern:
+//
+//	rules:
+//	  - fingerprint: disk_full
+//	    pattern: (?i)no space left
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read error rules file: %w", err)
+	}
+
+	var rf rulesFile
+	if err := yaml.Unmarshal(data, &rf); err != nil {
+		return nil, fmt.Errorf("failed to parse error rules file %s: %w", path, err)
+	}
+
+	rules := make([]Rule, 0, len(rf.Rules))
+	for i, r := range rf.Rules {
+		if !fingerprintRegexp.MatchString(r.Fingerprint) {
+			return nil, fmt.Errorf("rule #%d: fingerprint must only contain lowercase letters, digits or '_'", i+1)
+		}
+
+		if r.Pattern == "" {
+			return nil, fmt.Errorf("rule #%d: pattern must not be empty", i+1)
+		}
+
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule #%d: invalid pattern: %w", i+1, err)
+		}
+
+		rules = append(rules, Rule{Fingerprint: r.Fingerprint, Pattern: pattern})
+	}
+
+	return rules, nil
+}
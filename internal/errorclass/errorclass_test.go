@@ -0,0 +1,93 @@
+package errorclass
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Classifier_Classify(t *testing.T) {
+	t.Parallel()
+
+	c := NewClassifier(DefaultRules()...)
+
+	tests := map[string]string{
+		"Out of memory: query requires 12GiB, 8GiB available": "out_of_memory",
+		"Query timed out after 3600 seconds":                  "timeout",
+		"Permission denied for table orders":                  "permission_denied",
+		"syntax error at or near \"SELEC\"":                   "syntax_error",
+		"relation \"orders\" does not exist":                  "not_found",
+		"Division by zero":                                    Other,
+		"":                                                    Other,
+	}
+
+	for message, fingerprint := range tests {
+		require.Equal(t, fingerprint, c.Classify(message), message)
+	}
+}
+
+func Test_LoadRules(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+rules:
+  - fingerprint: disk_full
+    pattern: (?i)no space left
+  - fingerprint: timeout
+    pattern: (?i)took too long
+`), 0o600))
+
+	rules, err := LoadRules(path)
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+
+	// the rules of the file are applied before the default ones
+	c := NewClassifier(append(rules, DefaultRules()...)...)
+	require.Equal(t, "disk_full", c.Classify("No space left on device"))
+	require.Equal(t, "timeout", c.Classify("The query took too long"))
+	require.Equal(t, "out_of_memory", c.Classify("out of memory"))
+}
+
+func Test_LoadRules_invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		content string
+		err     string
+	}{
+		"invalid yaml": {
+			content: "rules: [",
+			err:     "failed to parse error rules file",
+		},
+		"invalid fingerprint": {
+			content: "rules:\n  - fingerprint: Disk Full\n    pattern: no space\n",
+			err:     "rule #1: fingerprint must only contain lowercase letters, digits or '_'",
+		},
+		"empty pattern": {
+			content: "rules:\n  - fingerprint: disk_full\n",
+			err:     "rule #1: pattern must not be empty",
+		},
+		"invalid pattern": {
+			content: "rules:\n  - fingerprint: disk_full\n    pattern: (no space\n",
+			err:     "rule #1: invalid pattern",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "rules.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o600))
+
+			_, err := LoadRules(path)
+			require.ErrorContains(t, err, tt.err)
+		})
+	}
+
+	_, err := LoadRules(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.ErrorContains(t, err, "failed to read error rules file")
+}
@@ -5,12 +5,66 @@ import (
 	"fmt"
 	"net"
 
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"google.golang.org/grpc"
 )
 
 // NewGRPCExporter creates a new instance of otlpmetricgrpc.Exporter
 func NewGRPCExporter(ctx context.Context, cfg *Config) (*otlpmetricgrpc.Exporter, error) {
+	conn, err := dial(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter, err := otlpmetricgrpc.New(ctx,
+		otlpmetricgrpc.WithGRPCConn(conn),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return exporter, nil
+}
+
+// NewGRPCLogExporter creates a new instance of otlploggrpc.Exporter, which uses the same settings as the metrics one.
+func NewGRPCLogExporter(ctx context.Context, cfg *Config) (*otlploggrpc.Exporter, error) {
+	conn, err := dial(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter, err := otlploggrpc.New(ctx,
+		otlploggrpc.WithGRPCConn(conn),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return exporter, nil
+}
+
+// NewGRPCTraceExporter creates a new instance of otlptrace.Exporter, which uses the same settings as the metrics one.
+func NewGRPCTraceExporter(ctx context.Context, cfg *Config) (*otlptrace.Exporter, error) {
+	conn, err := dial(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter, err := otlptracegrpc.New(ctx,
+		otlptracegrpc.WithGRPCConn(conn),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return exporter, nil
+}
+
+// dial creates a new gRPC client connection to the Opentelemetry Collector.
+func dial(cfg *Config) (*grpc.ClientConn, error) {
 	dialOpts, err := cfg.DialOptions()
 	if err != nil {
 		return nil, err
@@ -27,12 +81,5 @@ func NewGRPCExporter(ctx context.Context, cfg *Config) (*otlpmetricgrpc.Exporter
 		return nil, fmt.Errorf("failed to dial: %w", err)
 	}
 
-	exporter, err := otlpmetricgrpc.New(ctx,
-		otlpmetricgrpc.WithGRPCConn(conn),
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	return exporter, nil
+	return conn, nil
 }
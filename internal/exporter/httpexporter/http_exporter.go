@@ -5,24 +5,17 @@ import (
 	"crypto/tls"
 	"fmt"
 
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 )
 
 // NewHTTPExporter creates a new instance of otlpmetrichttp.Exporter
 func NewHTTPExporter(ctx context.Context, cfg *Config) (*otlpmetrichttp.Exporter, error) {
-	// configure TLS
-	var tlsConfig *tls.Config
-	if cfg.TLS != nil {
-		cert, err := tls.X509KeyPair(
-			[]byte(cfg.TLS.X509KeyPair.CertPEMBlock),
-			[]byte(cfg.TLS.X509KeyPair.KeyPEMBlock),
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read X509KeyPair: %w", err)
-		}
-		tlsConfig = &tls.Config{
-			Certificates: []tls.Certificate{cert},
-		}
+	tlsConfig, err := cfg.tlsConfig()
+	if err != nil {
+		return nil, err
 	}
 
 	var opts = []otlpmetrichttp.Option{
@@ -43,3 +36,74 @@ func NewHTTPExporter(ctx context.Context, cfg *Config) (*otlpmetrichttp.Exporter
 
 	return exporter, nil
 }
+
+// NewHTTPLogExporter creates a new instance of otlploghttp.Exporter, which uses the same settings as the metrics one.
+func NewHTTPLogExporter(ctx context.Context, cfg *Config) (*otlploghttp.Exporter, error) {
+	tlsConfig, err := cfg.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var opts = []otlploghttp.Option{
+		otlploghttp.WithEndpoint(cfg.Address),
+	}
+
+	if tlsConfig != nil {
+		opts = append(opts, otlploghttp.WithTLSClientConfig(tlsConfig))
+	} else {
+		opts = append(opts, otlploghttp.WithInsecure())
+	}
+
+	exporter, err := otlploghttp.New(ctx, opts...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return exporter, nil
+}
+
+// NewHTTPTraceExporter creates a new instance of otlptrace.Exporter, which uses the same settings as the metrics one.
+func NewHTTPTraceExporter(ctx context.Context, cfg *Config) (*otlptrace.Exporter, error) {
+	tlsConfig, err := cfg.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var opts = []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(cfg.Address),
+	}
+
+	if tlsConfig != nil {
+		opts = append(opts, otlptracehttp.WithTLSClientConfig(tlsConfig))
+	} else {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(ctx, opts...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return exporter, nil
+}
+
+// tlsConfig returns the TLS configuration of the connection, or nil if the connection is insecure.
+func (c *Config) tlsConfig() (*tls.Config, error) {
+	if c.TLS == nil {
+		return nil, nil
+	}
+
+	cert, err := tls.X509KeyPair(
+		[]byte(c.TLS.X509KeyPair.CertPEMBlock),
+		[]byte(c.TLS.X509KeyPair.KeyPEMBlock),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read X509KeyPair: %w", err)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}, nil
+}
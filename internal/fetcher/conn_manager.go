@@ -0,0 +1,206 @@
+package fetcher
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"sync"
+)
+
+// errConnManagerClosed is returned when a connection is requested from the connManager which was already closed.
+var errConnManagerClosed = errors.New("connection manager is closed")
+
+// connKey identifies a connection pool of a single engine in an account. An empty engine name refers to the
+// system engine of the account.
+type connKey struct {
+	account string
+	engine  string
+}
+
+// openFn opens a new connection pool for an engine in an account.
+type openFn func(ctx context.Context, accountName, engineName string) (*sql.DB, error)
+
+// connEntry is a connection pool of the connManager, which may still be opening.
+type connEntry struct {
+	// ready is closed once the pool is opened, or failed to open.
+	ready chan struct{}
+	db    *sql.DB
+	err   error
+}
+
+// connManager keeps one sql.DB pool per account and engine, so that the pools (and the sessions they hold)
+// are reused across collection cycles instead of authenticating on every query.
+type connManager struct {
+	open openFn
+
+	// mu guards pools and closed. It is never held while a pool is opened, so that the pools of the other
+	// engines can be used meanwhile.
+	mu     sync.Mutex
+	pools  map[connKey]*connEntry
+	closed bool
+}
+
+// newConnManager creates a new instance of connManager, which uses provided function to open new pools.
+func newConnManager(open openFn) *connManager {
+	return &connManager{
+		open:  open,
+		pools: make(map[connKey]*connEntry),
+	}
+}
+
+// get returns a connection pool for specified account and engine. The pool is opened on first use. Concurrent
+// calls for the same account and engine wait for the pool opened by the first one, until their context is done.
+func (m *connManager) get(ctx context.Context, accountName, engineName string) (*sql.DB, error) {
+	key := connKey{account: accountName, engine: engineName}
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, errConnManagerClosed
+	}
+
+	if entry, ok := m.pools[key]; ok {
+		m.mu.Unlock()
+
+		select {
+		case <-entry.ready:
+			return entry.db, entry.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	entry := &connEntry{ready: make(chan struct{})}
+	m.pools[key] = entry
+	m.mu.Unlock()
+
+	db, err := m.open(ctx, accountName, engineName)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer close(entry.ready)
+
+	switch {
+	case err != nil:
+		entry.err = err
+		m.drop(key, entry)
+	case m.closed:
+		// the manager was closed while the pool was opening, so nobody would close the pool.
+		closePool(key, db)
+		entry.err = errConnManagerClosed
+	default:
+		entry.db = db
+	}
+
+	return entry.db, entry.err
+}
+
+// drop removes the entry of the key, unless it was already replaced by another one.
+func (m *connManager) drop(key connKey, entry *connEntry) {
+	if m.pools[key] == entry {
+		delete(m.pools, key)
+	}
+}
+
+// invalidate closes and drops the pool of specified account and engine, so that the next call to get
+// will open a new one. It should be called once the session of the pool is considered to be lost.
+// The pool is only dropped if it's still the provided one, so that a pool already reopened by another caller
+// is kept.
+func (m *connManager) invalidate(accountName, engineName string, db *sql.DB) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := connKey{account: accountName, engine: engineName}
+	if entry, ok := m.pools[key]; ok && entry.db == db {
+		delete(m.pools, key)
+		closePool(key, db)
+	}
+}
+
+// retain closes and drops the pools of the account, which belong to engines not present in the provided list.
+// The pool of the system engine is always kept, as well as the pools, which are still opening.
+func (m *connManager) retain(accountName string, engines []Engine) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	running := make(map[string]struct{}, len(engines))
+	for _, engine := range engines {
+		running[engine.Name] = struct{}{}
+	}
+
+	for key, entry := range m.pools {
+		if key.account != accountName || key.engine == "" || !isReady(entry) {
+			continue
+		}
+
+		if _, ok := running[key.engine]; !ok {
+			delete(m.pools, key)
+			closePool(key, entry.db)
+		}
+	}
+}
+
+// Close closes all the pools. The pools, which are still opening, are closed once they are opened.
+// The connManager can't be used after it is closed.
+func (m *connManager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var errs []error
+	for key, entry := range m.pools {
+		if isReady(entry) {
+			if err := entry.db.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		delete(m.pools, key)
+	}
+	m.closed = true
+
+	return errors.Join(errs...)
+}
+
+// isReady tells whether the pool of the entry is opened. Entries, which failed to open, are never stored.
+func isReady(entry *connEntry) bool {
+	select {
+	case <-entry.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// closePool closes the pool and logs the error, if any.
+func closePool(key connKey, db *sql.DB) {
+	if err := db.Close(); err != nil {
+		slog.Error("failed to close database connection",
+			slog.String("accountName", key.account), slog.String("engineName", key.engine),
+			slog.Any("error", err),
+		)
+	}
+}
+
+// openLock allows a single pool to be opened at a time, since the firebolt driver keeps authentication state
+// in a shared driver instance, which is not safe to use concurrently. Unlike a mutex, the callers waiting
+// for the lock give up once their context is done.
+type openLock chan struct{}
+
+func newOpenLock() openLock {
+	return make(openLock, 1)
+}
+
+// lock acquires the lock, or returns the error of the context, if it's done first.
+func (l openLock) lock(ctx context.Context) error {
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// unlock releases the lock.
+func (l openLock) unlock() {
+	<-l
+}
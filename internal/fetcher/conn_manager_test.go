@@ -0,0 +1,226 @@
+package fetcher
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_connManager_get(t *testing.T) {
+	t.Parallel()
+
+	opened := 0
+	m := newConnManager(func(ctx context.Context, accountName, engineName string) (*sql.DB, error) {
+		opened++
+		return sql.OpenDB(connectorMock{}), nil
+	})
+	t.Cleanup(func() { require.NoError(t, m.Close()) })
+
+	db1, err := m.get(context.Background(), "acct", "eng")
+	require.NoError(t, err)
+
+	// pool is reused for the same account and engine
+	db2, err := m.get(context.Background(), "acct", "eng")
+	require.NoError(t, err)
+	require.Same(t, db1, db2)
+	require.Equal(t, 1, opened)
+
+	// another engine gets its own pool
+	db3, err := m.get(context.Background(), "acct", "eng2")
+	require.NoError(t, err)
+	require.NotSame(t, db1, db3)
+	require.Equal(t, 2, opened)
+}
+
+func Test_connManager_get_error(t *testing.T) {
+	t.Parallel()
+
+	m := newConnManager(func(ctx context.Context, accountName, engineName string) (*sql.DB, error) {
+		return nil, errors.New("auth failed")
+	})
+
+	db, err := m.get(context.Background(), "acct", "eng")
+	require.ErrorContains(t, err, "auth failed")
+	require.Nil(t, db)
+	require.Empty(t, m.pools)
+}
+
+func Test_connManager_invalidate(t *testing.T) {
+	t.Parallel()
+
+	m := newConnManager(func(ctx context.Context, accountName, engineName string) (*sql.DB, error) {
+		return sql.OpenDB(connectorMock{}), nil
+	})
+	t.Cleanup(func() { require.NoError(t, m.Close()) })
+
+	db1, err := m.get(context.Background(), "acct", "eng")
+	require.NoError(t, err)
+
+	m.invalidate("acct", "eng", db1)
+	require.ErrorContains(t, db1.Ping(), "database is closed")
+
+	db2, err := m.get(context.Background(), "acct", "eng")
+	require.NoError(t, err)
+	require.NotSame(t, db1, db2)
+
+	// another caller, which failed on the already invalidated pool, doesn't drop the reopened one
+	m.invalidate("acct", "eng", db1)
+
+	db3, err := m.get(context.Background(), "acct", "eng")
+	require.NoError(t, err)
+	require.Same(t, db2, db3)
+}
+
+func Test_connManager_get_concurrent(t *testing.T) {
+	t.Parallel()
+
+	opening := make(chan struct{})
+	release := make(chan struct{})
+	opened := atomic.Int32{}
+	m := newConnManager(func(ctx context.Context, accountName, engineName string) (*sql.DB, error) {
+		opened.Add(1)
+		if engineName == "slow" {
+			close(opening)
+			<-release
+		}
+		return sql.OpenDB(connectorMock{}), nil
+	})
+	t.Cleanup(func() { require.NoError(t, m.Close()) })
+
+	cached, err := m.get(context.Background(), "acct", "eng")
+	require.NoError(t, err)
+
+	slowCh := make(chan *sql.DB)
+	errCh := make(chan error, 1)
+	go func() {
+		db, err := m.get(context.Background(), "acct", "slow")
+		errCh <- err
+		slowCh <- db
+	}()
+	<-opening
+
+	// the pools of the other engines are available while a pool is opening
+	db, err := m.get(context.Background(), "acct", "eng")
+	require.NoError(t, err)
+	require.Same(t, cached, db)
+
+	// callers waiting for the same pool give up once their context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	t.Cleanup(cancel)
+	_, err = m.get(ctx, "acct", "slow")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	close(release)
+	slow := <-slowCh
+	require.NoError(t, <-errCh)
+
+	// the pool is opened only once
+	db, err = m.get(context.Background(), "acct", "slow")
+	require.NoError(t, err)
+	require.Same(t, slow, db)
+	require.Equal(t, int32(2), opened.Load())
+}
+
+func Test_connManager_Close_opening(t *testing.T) {
+	t.Parallel()
+
+	opening := make(chan struct{})
+	release := make(chan struct{})
+	db := sql.OpenDB(connectorMock{})
+	m := newConnManager(func(ctx context.Context, accountName, engineName string) (*sql.DB, error) {
+		close(opening)
+		<-release
+		return db, nil
+	})
+
+	errCh := make(chan error)
+	go func() {
+		_, err := m.get(context.Background(), "acct", "eng")
+		errCh <- err
+	}()
+	<-opening
+
+	require.NoError(t, m.Close())
+	close(release)
+
+	// the pool opened after the manager was closed is closed right away
+	require.ErrorIs(t, <-errCh, errConnManagerClosed)
+	require.ErrorContains(t, db.Ping(), "database is closed")
+}
+
+func Test_openLock(t *testing.T) {
+	t.Parallel()
+
+	l := newOpenLock()
+	require.NoError(t, l.lock(context.Background()))
+
+	// waiters leave once their context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	t.Cleanup(cancel)
+	require.ErrorIs(t, l.lock(ctx), context.DeadlineExceeded)
+
+	l.unlock()
+	require.NoError(t, l.lock(context.Background()))
+}
+
+func Test_connManager_retain(t *testing.T) {
+	t.Parallel()
+
+	m := newConnManager(func(ctx context.Context, accountName, engineName string) (*sql.DB, error) {
+		return sql.OpenDB(connectorMock{}), nil
+	})
+	t.Cleanup(func() { require.NoError(t, m.Close()) })
+
+	for _, key := range []connKey{
+		{account: "acct", engine: ""},
+		{account: "acct", engine: "eng1"},
+		{account: "acct", engine: "eng2"},
+		{account: "acct2", engine: "eng1"},
+	} {
+		_, err := m.get(context.Background(), key.account, key.engine)
+		require.NoError(t, err)
+	}
+
+	m.retain("acct", []Engine{{Name: "eng1", Status: "RUNNING"}})
+
+	// the system engine, running engine and engines of other accounts are kept
+	require.Len(t, m.pools, 3)
+	require.Contains(t, m.pools, connKey{account: "acct", engine: ""})
+	require.Contains(t, m.pools, connKey{account: "acct", engine: "eng1"})
+	require.Contains(t, m.pools, connKey{account: "acct2", engine: "eng1"})
+}
+
+func Test_connManager_Close(t *testing.T) {
+	t.Parallel()
+
+	m := newConnManager(func(ctx context.Context, accountName, engineName string) (*sql.DB, error) {
+		return sql.OpenDB(connectorMock{}), nil
+	})
+
+	db, err := m.get(context.Background(), "acct", "eng")
+	require.NoError(t, err)
+
+	require.NoError(t, m.Close())
+	require.ErrorContains(t, db.Ping(), "database is closed")
+	require.Empty(t, m.pools)
+
+	_, err = m.get(context.Background(), "acct", "eng")
+	require.ErrorIs(t, err, errConnManagerClosed)
+}
+
+// connectorMock is a driver.Connector, which never connects.
+type connectorMock struct{}
+
+func (connectorMock) Connect(context.Context) (driver.Conn, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (connectorMock) Driver() driver.Driver {
+	return nil
+}
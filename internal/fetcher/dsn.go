@@ -0,0 +1,71 @@
+package fetcher
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// dsnValueRegexp matches the values, which can be passed in the connection string of the firebolt driver.
+	// The driver doesn't decode the values of the connection string, so its separators can't be escaped.
+	dsnValueRegexp = regexp.MustCompile(`^[^=&]+$`)
+
+	// setValueRegexp matches the values, which can be passed in a SET statement. The driver passes the value
+	// of a SET statement as is, so it can't be quoted.
+	setValueRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// dsn specifies the parameters of a connection string of the firebolt driver. The driver accepts no other parameters,
+// so neither the timeouts nor the user agent can be passed in the connection string.
+type dsn struct {
+	accountName  string
+	clientID     string
+	clientSecret string
+	// engineName is optional, the connection is made to the system engine if it's empty.
+	engineName string
+}
+
+// build returns the connection string. It fails if any of the parameters can't be passed to the driver.
+func (d dsn) build() (string, error) {
+	params := []struct {
+		name, value string
+	}{
+		{name: "account_name", value: d.accountName},
+		{name: "client_id", value: d.clientID},
+		{name: "client_secret", value: d.clientSecret},
+		// the driver selects the engine with a `USE ENGINE "<engine>"` statement, so the quotes of the name are
+		// escaped to keep it a single identifier.
+		{name: "engine", value: strings.ReplaceAll(d.engineName, `"`, `""`)},
+	}
+
+	pairs := make([]string, 0, len(params))
+	for _, p := range params {
+		if p.name == "engine" && p.value == "" {
+			continue
+		}
+
+		if !dsnValueRegexp.MatchString(p.value) {
+			return "", fmt.Errorf("%s must not be empty or contain '=' or '&'", p.name)
+		}
+
+		pairs = append(pairs, p.name+"="+p.value)
+	}
+
+	return "firebolt://?" + strings.Join(pairs, "&"), nil
+}
+
+// setStatement returns a SET statement of the session parameter. It fails if the value can't be passed to the driver.
+func setStatement(name, value string) (string, error) {
+	if !setValueRegexp.MatchString(value) {
+		return "", fmt.Errorf("value of %s must only contain letters, digits, '_', '.' or '-'", name)
+	}
+
+	return fmt.Sprintf("SET %s=%s;", name, value), nil
+}
+
+// timestampParam formats the time as a query parameter, which is compared with TIMESTAMPTZ columns.
+func timestampParam(t time.Time) string {
+	return t.UTC().Format(time.DateTime + "-07")
+}
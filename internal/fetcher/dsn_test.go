@@ -0,0 +1,106 @@
+package fetcher
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_dsn_build(t *testing.T) {
+	t.Parallel()
+
+	// system engine
+	connStr, err := dsn{accountName: "acc", clientID: "id", clientSecret: "s3cr3t!#%"}.build()
+	require.NoError(t, err)
+	require.Equal(t, "firebolt://?account_name=acc&client_id=id&client_secret=s3cr3t!#%", connStr)
+
+	// user engine with a name, which would break a quoted identifier, is escaped
+	connStr, err = dsn{accountName: "acc", clientID: "id", clientSecret: "secret", engineName: `eng"; DROP TABLE x; --`}.build()
+	require.NoError(t, err)
+	require.Equal(t, `firebolt://?account_name=acc&client_id=id&client_secret=secret&engine=eng""; DROP TABLE x; --`, connStr)
+
+	// the statement the driver selects the engine with quotes the whole name as a single identifier
+	engine := strings.TrimPrefix(connStr, "firebolt://?account_name=acc&client_id=id&client_secret=secret&engine=")
+	ident, rest := unquoteIdentifier(strings.TrimPrefix(fmt.Sprintf(`USE ENGINE "%s"`, engine), "USE ENGINE "))
+	require.Equal(t, `eng"; DROP TABLE x; --`, ident)
+	require.Empty(t, rest)
+}
+
+// unquoteIdentifier reads the double-quoted identifier at the start of the statement, and returns it along with
+// the rest of the statement.
+func unquoteIdentifier(stmt string) (string, string) {
+	var sb strings.Builder
+	for i := 1; i < len(stmt); i++ {
+		if stmt[i] != '"' {
+			sb.WriteByte(stmt[i])
+			continue
+		}
+
+		if i+1 < len(stmt) && stmt[i+1] == '"' {
+			sb.WriteByte('"')
+			i++
+			continue
+		}
+
+		return sb.String(), stmt[i+1:]
+	}
+
+	return sb.String(), ""
+}
+
+func Test_dsn_build_hostile(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		dsn dsn
+		err string
+	}{
+		"account injects engine": {
+			dsn: dsn{accountName: "acc&engine=other", clientID: "id", clientSecret: "secret"},
+			err: "account_name must not be empty or contain '=' or '&'",
+		},
+		"engine injects account": {
+			dsn: dsn{accountName: "acc", clientID: "id", clientSecret: "secret", engineName: "eng&account_name=other"},
+			err: "engine must not be empty or contain '=' or '&'",
+		},
+		"secret with separator": {
+			dsn: dsn{accountName: "acc", clientID: "id", clientSecret: "a=b"},
+			err: "client_secret must not be empty or contain '=' or '&'",
+		},
+		"empty client id": {
+			dsn: dsn{accountName: "acc", clientSecret: "secret"},
+			err: "client_id must not be empty or contain '=' or '&'",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			connStr, err := tc.dsn.build()
+			require.EqualError(t, err, tc.err)
+			require.Empty(t, connStr)
+		})
+	}
+}
+
+func Test_setStatement(t *testing.T) {
+	t.Parallel()
+
+	stmt, err := setStatement("query_label", "otel-exporter_1.0")
+	require.NoError(t, err)
+	require.Equal(t, "SET query_label=otel-exporter_1.0;", stmt)
+
+	for _, value := range []string{"", "a b", "a;DROP TABLE x", "a'b", "a=b"} {
+		_, err := setStatement("query_label", value)
+		require.EqualError(t, err, "value of query_label must only contain letters, digits, '_', '.' or '-'")
+	}
+}
+
+func Test_timestampParam(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Date(2024, 1, 1, 12, 0, 30, 0, time.FixedZone("CET", 3600))
+	require.Equal(t, "2024-01-01 11:00:30+00", timestampParam(ts))
+}
@@ -3,60 +3,106 @@ package fetcher
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	_ "github.com/firebolt-db/firebolt-go-sdk"
 )
 
+// DefaultQueryLabel is the query label of the exporter's queries, unless another one is configured.
+const DefaultQueryLabel = "otel-exporter"
+
 // Fetcher is an interface that the metrics fetcher should implement.
 type Fetcher interface {
 	// FetchEngines reads a list of running engines in a single account.
 	FetchEngines(ctx context.Context, accountName string) ([]Engine, error)
 
+	// FetchServerTime reads the current time of Firebolt from the system engine of the account.
+	FetchServerTime(ctx context.Context, accountName string) (time.Time, error)
+
 	// FetchRuntimePoints returns a channel of EngineRuntimePoint and pushes data into that channel asynchronously.
-	// It should close the channel when all data points are pushed.
+	// It should close the channel when all data points are pushed. Data points of each engine are pushed in
+	// chronological order.
 	// The metrics should be collected within the provided time interval.
-	FetchRuntimePoints(ctx context.Context, account string, engines []Engine, since, till time.Time) <-chan EngineRuntimePoint
+	// The second channel receives an *EngineError for each engine, which data points could not be fetched completely.
+	// It is buffered, so it should be read after the channel of data points is closed.
+	// Once the context is done, no more data points are pushed, and both channels are closed.
+	FetchRuntimePoints(ctx context.Context, account string, engines []Engine, since, till time.Time) (<-chan EngineRuntimePoint, <-chan error)
 
 	// FetchQueryHistoryPoints returns a channel of QueryHistoryPoint and pushes data into that channel asynchronously
 	// It should close the channel when all data points are pushed.
 	// The metrics should be collected within the provided time interval.
-	FetchQueryHistoryPoints(ctx context.Context, account string, engines []Engine, since, till time.Time) <-chan QueryHistoryPoint
+	// The second channel receives an *EngineError for each engine, which data points could not be fetched completely.
+	// It is buffered, so it should be read after the channel of data points is closed.
+	// Once the context is done, no more data points are pushed, and both channels are closed.
+	FetchQueryHistoryPoints(ctx context.Context, account string, engines []Engine, since, till time.Time) (<-chan QueryHistoryPoint, <-chan error)
+
+	// Close releases the connections held by the fetcher.
+	Close() error
 }
 
 // fetcher is an implementation of Fetcher interface.
 type fetcher struct {
 	clientID, clientSecret string
+
+	// queryLabel is set as the query label of the exporter's sessions, so that its queries can be told apart
+	// in query history.
+	queryLabel string
+
+	// allRuntimeSamples defines whether all the runtime samples within the time interval are read.
+	allRuntimeSamples bool
+
+	// engineTimeout limits how long the data points of a single engine are fetched. Zero means no limit.
+	engineTimeout time.Duration
+
+	// maxConnections limits the number of queries run concurrently across all the accounts and engines.
+	// Zero means no limit.
+	maxConnections int
+	limiter        *connLimiter
+
+	conns    *connManager
+	openLock openLock
 }
 
 // New creates a new instance of Fetcher, using Firebolt Service Account credentials provided.
-func New(clientID, clientSecret string) Fetcher {
-	return &fetcher{
+func New(clientID, clientSecret string, options ...Option) Fetcher {
+	f := &fetcher{
 		clientID:     clientID,
 		clientSecret: clientSecret,
+		queryLabel:   DefaultQueryLabel,
 	}
+
+	for _, opt := range options {
+		f = opt.apply(f)
+	}
+
+	f.limiter = newConnLimiter(f.maxConnections)
+	f.conns = newConnManager(f.connect)
+	f.openLock = newOpenLock()
+
+	return f
+}
+
+// Close closes all the connections opened by the fetcher.
+func (f *fetcher) Close() error {
+	return f.conns.Close()
 }
 
 // FetchEngines returns a list of running engines in account.
 func (f *fetcher) FetchEngines(ctx context.Context, accountName string) ([]Engine, error) {
-	// connect to a system engine to read running engines.
-	db, err := f.connect(ctx, accountName, "")
-	if err != nil {
+	if err := f.limiter.acquire(ctx); err != nil {
 		return nil, err
 	}
+	defer f.limiter.release()
 
-	defer func() {
-		if err := db.Close(); err != nil {
-			slog.ErrorContext(ctx, "failed to close database connection", slog.Any("error", err))
-		}
-	}()
-
-	// we are only interested in running engines.
-	rows, err := db.QueryContext(ctx,
+	// query a system engine to read running engines, we are only interested in running engines.
+	rows, err := f.queryContext(ctx, accountName, "",
 		`SELECT engine_name, status FROM information_schema.engines WHERE status IN ('RUNNING', 'RESIZING', 'DRAINING');`,
 	)
 	if err != nil {
@@ -80,12 +126,53 @@ func (f *fetcher) FetchEngines(ctx context.Context, accountName string) ([]Engin
 		engines = append(engines, engine)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// connections to the engines which are not running anymore are not needed.
+	f.conns.retain(accountName, engines)
+
 	return engines, nil
 }
 
+// FetchServerTime returns the current time of Firebolt.
+func (f *fetcher) FetchServerTime(ctx context.Context, accountName string) (time.Time, error) {
+	if err := f.limiter.acquire(ctx); err != nil {
+		return time.Time{}, err
+	}
+	defer f.limiter.release()
+
+	rows, err := f.queryContext(ctx, accountName, "", `SELECT CURRENT_TIMESTAMP;`)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.ErrorContext(ctx, "failed to close rows", slog.Any("error", err))
+		}
+	}()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return time.Time{}, err
+		}
+		return time.Time{}, sql.ErrNoRows
+	}
+
+	var now time.Time
+	if err := rows.Scan(&now); err != nil {
+		return time.Time{}, err
+	}
+
+	return now.UTC(), nil
+}
+
 // FetchRuntimePoints returns a channel of EngineRuntimePoint.
-func (f *fetcher) FetchRuntimePoints(ctx context.Context, account string, engines []Engine, since, till time.Time) <-chan EngineRuntimePoint {
+func (f *fetcher) FetchRuntimePoints(ctx context.Context, account string, engines []Engine, since, till time.Time) (<-chan EngineRuntimePoint, <-chan error) {
 	ch := make(chan EngineRuntimePoint)
+	errCh := make(chan error, len(engines))
 
 	go func() {
 		wg := sync.WaitGroup{}
@@ -97,65 +184,108 @@ func (f *fetcher) FetchRuntimePoints(ctx context.Context, account string, engine
 			go func(engine Engine) {
 				defer wg.Done()
 
-				// connect to an engine
-				engDb, err := f.connect(ctx, account, engine.Name)
+				// the engine timeout starts once the query is allowed to run.
+				if err := f.limiter.acquire(ctx); err != nil {
+					errCh <- engineError(ctx, engine.Name, err)
+					return
+				}
+				defer f.limiter.release()
+
+				ctx, cancel := f.engineContext(ctx)
+				defer cancel()
+
+				// read the metrics within the time interval. Unless all the samples are requested,
+				// only the most recent one of each cluster of the engine is read.
+				rows, err := f.queryContext(ctx, account, engine.Name, runtimeQuery(f.allRuntimeSamples),
+					timestampParam(since), timestampParam(till),
+				)
 				if err != nil {
-					slog.ErrorContext(ctx, "failed to connect to engine",
+					slog.ErrorContext(ctx, "failed to read engine metrics",
 						slog.String("accountName", account), slog.String("engineName", engine.Name),
 						slog.Any("error", err),
 					)
+					errCh <- engineError(ctx, engine.Name, err)
 					return
 				}
+
 				defer func() {
-					if err := engDb.Close(); err != nil {
-						slog.ErrorContext(ctx, "failed to close engine database connection",
+					if err := rows.Close(); err != nil {
+						slog.ErrorContext(ctx, "failed to close rows",
 							slog.String("accountName", account), slog.String("engineName", engine.Name),
 							slog.Any("error", err),
 						)
 					}
 				}()
 
-				// read the metrics. Only interested in most recent metric within the time interval.
-				row := engDb.QueryRowContext(ctx,
-					fmt.Sprintf(
-						`SELECT engine_cluster, event_time, cpu_used, memory_used, disk_used, 
-       						cache_hit_ratio, spilled_bytes, running_queries, suspended_queries  
-				FROM information_schema.engine_metrics_history 
-         		WHERE event_time > TIMESTAMPTZ '%s' AND event_time <= TIMESTAMPTZ '%s' 
-         		ORDER BY event_time DESC LIMIT 1;`,
-						since.Format(time.DateTime+"-07"), till.Format(time.DateTime+"-07"),
-					))
-
-				// prepare the metric point.
-				erp := EngineRuntimePoint{
-					EngineName:   engine.Name,
-					EngineStatus: engine.Status,
-				}
-				if err := erp.Scan(row); err != nil {
-					if !errors.Is(err, sql.ErrNoRows) {
+				// prepare the metric points, there are none if no metrics were reported within the time interval.
+				for rows.Next() {
+					erp := EngineRuntimePoint{
+						EngineName:   engine.Name,
+						EngineStatus: engine.Status,
+					}
+					if err := erp.Scan(rows); err != nil {
 						slog.ErrorContext(ctx, "failed to scan engine metric",
 							slog.String("accountName", account), slog.String("engineName", engine.Name),
 							slog.Any("error", err),
 						)
+						errCh <- engineError(ctx, engine.Name, err)
+						return
+					}
+
+					// stop fetching, if the consumer or the engine timeout is done before the point is pushed.
+					if err := send(ctx, ch, erp); err != nil {
+						errCh <- engineError(ctx, engine.Name, err)
+						return
 					}
-					return
 				}
 
-				ch <- erp
+				if err := rows.Err(); err != nil {
+					slog.ErrorContext(ctx, "failed to read engine metrics",
+						slog.String("accountName", account), slog.String("engineName", engine.Name),
+						slog.Any("error", err),
+					)
+					errCh <- engineError(ctx, engine.Name, err)
+				}
 			}(eng)
 		}
 
 		// wait until all engines metrics are pushed and close the channel
 		wg.Wait()
 		close(ch)
+		close(errCh)
 	}()
 
-	return ch
+	return ch, errCh
+}
+
+// runtimeQuery returns the query, which reads the engine runtime metrics within the time interval provided
+// as its parameters.
+func runtimeQuery(allSamples bool) string {
+	if allSamples {
+		return `SELECT engine_cluster, event_time, cpu_used, memory_used, disk_used, 
+       		cache_hit_ratio, spilled_bytes, running_queries, suspended_queries  
+		FROM information_schema.engine_metrics_history 
+		WHERE event_time > TIMESTAMPTZ ? AND event_time <= TIMESTAMPTZ ? 
+		ORDER BY event_time;`
+	}
+
+	return `SELECT engine_cluster, event_time, cpu_used, memory_used, disk_used, 
+       	cache_hit_ratio, spilled_bytes, running_queries, suspended_queries  
+	FROM (
+		SELECT engine_cluster, event_time, cpu_used, memory_used, disk_used, 
+			cache_hit_ratio, spilled_bytes, running_queries, suspended_queries,
+			ROW_NUMBER() OVER (PARTITION BY engine_cluster ORDER BY event_time DESC) AS rn
+		FROM information_schema.engine_metrics_history 
+		WHERE event_time > TIMESTAMPTZ ? AND event_time <= TIMESTAMPTZ ?
+	) AS latest
+	WHERE rn = 1
+	ORDER BY event_time;`
 }
 
 // FetchQueryHistoryPoints returns a channel of QueryHistoryPoint.
-func (f *fetcher) FetchQueryHistoryPoints(ctx context.Context, account string, engines []Engine, since, till time.Time) <-chan QueryHistoryPoint {
+func (f *fetcher) FetchQueryHistoryPoints(ctx context.Context, account string, engines []Engine, since, till time.Time) (<-chan QueryHistoryPoint, <-chan error) {
 	ch := make(chan QueryHistoryPoint)
+	errCh := make(chan error, len(engines))
 
 	go func() {
 		wg := sync.WaitGroup{}
@@ -167,43 +297,35 @@ func (f *fetcher) FetchQueryHistoryPoints(ctx context.Context, account string, e
 			go func(engine Engine) {
 				defer wg.Done()
 
-				// connect to an engine
-				engDb, err := f.connect(ctx, account, engine.Name)
-				if err != nil {
-					slog.ErrorContext(ctx, "failed to connect to engine",
-						slog.String("accountName", account), slog.String("engineName", engine.Name),
-						slog.Any("error", err),
-					)
+				// the engine timeout starts once the query is allowed to run.
+				if err := f.limiter.acquire(ctx); err != nil {
+					errCh <- engineError(ctx, engine.Name, err)
 					return
 				}
-				defer func() {
-					if err := engDb.Close(); err != nil {
-						slog.ErrorContext(ctx, "failed to close engine database connection",
-							slog.String("accountName", account), slog.String("engineName", engine.Name),
-							slog.Any("error", err),
-						)
-					}
-				}()
+				defer f.limiter.release()
+
+				ctx, cancel := f.engineContext(ctx)
+				defer cancel()
 
 				// read the metrics within provided time interval. Entries with status='STARTED_EXECUTION' do not provide
 				// any metrics data, so they are skipped.
-				rows, err := engDb.QueryContext(ctx,
-					fmt.Sprintf(
-						`SELECT account_name, user_name, duration_us, status, scanned_rows, scanned_bytes, 
-       						inserted_rows, inserted_bytes, spilled_bytes, returned_rows, returned_bytes, 
-							time_in_queue_us, e2e_duration_us
+				rows, err := f.queryContext(ctx, account, engine.Name,
+					`SELECT query_id, submitted_time, start_time, end_time, account_name, user_name, duration_us, status, 
+       					scanned_rows, scanned_bytes, inserted_rows, inserted_bytes, spilled_bytes, 
+						returned_rows, returned_bytes, time_in_queue_us, e2e_duration_us, query_label, error_message,
+						query_text, scanned_cache_bytes, scanned_storage_bytes, cpu_usage_us, cpu_delay_us
 					FROM information_schema.engine_query_history
 					WHERE status <> 'STARTED_EXECUTION' 
-						AND submitted_time > TIMESTAMPTZ '%s' AND submitted_time <= TIMESTAMPTZ '%s' 
+						AND submitted_time > TIMESTAMPTZ ? AND submitted_time <= TIMESTAMPTZ ? 
          		    ORDER BY submitted_time;`,
-						since.Format(time.DateTime+"-07"), till.Format(time.DateTime+"-07"),
-					),
+					timestampParam(since), timestampParam(till),
 				)
 				if err != nil {
 					slog.ErrorContext(ctx, "failed to read query history metrics",
 						slog.String("accountName", account), slog.String("engineName", engine.Name),
 						slog.Any("error", err),
 					)
+					errCh <- engineError(ctx, engine.Name, err)
 					return
 				}
 
@@ -223,18 +345,36 @@ func (f *fetcher) FetchQueryHistoryPoints(ctx context.Context, account string, e
 						EngineStatus: engine.Status,
 					}
 
-					if err := rows.Scan(&qhp.AccountName, &qhp.UserName, &qhp.DurationMicroSeconds, &qhp.Status,
+					if err := rows.Scan(&qhp.QueryID, &qhp.SubmittedTime, &qhp.StartTime, &qhp.EndTime,
+						&qhp.AccountName, &qhp.UserName, &qhp.DurationMicroSeconds, &qhp.Status,
 						&qhp.ScannedRows, &qhp.ScannedBytes, &qhp.InsertedRows, &qhp.InsertedBytes, &qhp.SpilledBytes,
 						&qhp.ReturnedRows, &qhp.ReturnedBytes, &qhp.TimeInQueueMicroSeconds, &qhp.GatewayDurationMicroSeconds,
+						&qhp.QueryLabel, &qhp.ErrorMessage, &qhp.QueryText,
+						&qhp.ScannedCacheBytes, &qhp.ScannedStorageBytes, &qhp.CPUUsageMicroSeconds, &qhp.CPUDelayMicroSeconds,
 					); err != nil {
 						slog.ErrorContext(ctx, "failed to scan query history metric",
 							slog.String("accountName", account), slog.String("engineName", engine.Name),
 							slog.Any("error", err),
 						)
+						errCh <- engineError(ctx, engine.Name, err)
 						return
 					}
 
-					ch <- qhp
+					qhp.Exporter = qhp.QueryLabel.Valid && qhp.QueryLabel.String == f.queryLabel
+
+					// stop fetching, if the consumer or the engine timeout is done before the point is pushed.
+					if err := send(ctx, ch, qhp); err != nil {
+						errCh <- engineError(ctx, engine.Name, err)
+						return
+					}
+				}
+
+				if err := rows.Err(); err != nil {
+					slog.ErrorContext(ctx, "failed to read query history metrics",
+						slog.String("accountName", account), slog.String("engineName", engine.Name),
+						slog.Any("error", err),
+					)
+					errCh <- engineError(ctx, engine.Name, err)
 				}
 			}(eng)
 		}
@@ -242,43 +382,145 @@ func (f *fetcher) FetchQueryHistoryPoints(ctx context.Context, account string, e
 		// wait until all engines metrics are pushed and close the channel
 		wg.Wait()
 		close(ch)
+		close(errCh)
 	}()
 
-	return ch
+	return ch, errCh
+}
+
+// engineContext returns the context of fetching the data points of a single engine, which is done once
+// the engine timeout passes.
+func (f *fetcher) engineContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if f.engineTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, f.engineTimeout)
+}
+
+// engineError returns the error reported for an engine, which data points could not be fetched completely.
+// In case the context of the engine is done, the error wraps the context error, so that the engines which
+// timed out can be told apart.
+func engineError(ctx context.Context, engineName string, err error) *EngineError {
+	if ctxErr := ctx.Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+		err = fmt.Errorf("%w: %w", ctxErr, err)
+	}
+
+	return &EngineError{EngineName: engineName, Err: err}
+}
+
+// send pushes the value to the channel, unless the context is done first.
+func send[T any](ctx context.Context, ch chan<- T, value T) error {
+	select {
+	case ch <- value:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// queryContext runs a query with provided parameters on the connection pool of specified account and engine.
+// The parameters are bound to the `?` placeholders of the query by the driver. In case the query fails because
+// the session of the pool was lost, the pool is dropped and the query is retried once using a new connection.
+// The other errors are returned as they are, so that a failing query doesn't make the fetcher authenticate again.
+func (f *fetcher) queryContext(ctx context.Context, accountName, engineName, query string, args ...any) (*sql.Rows, error) {
+	db, err := f.conns.get(ctx, accountName, engineName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err == nil || ctx.Err() != nil || !isSessionLost(err) {
+		return rows, err
+	}
+
+	slog.DebugContext(ctx, "session lost, reconnecting",
+		slog.String("accountName", accountName), slog.String("engineName", engineName),
+		slog.Any("error", err),
+	)
+	f.conns.invalidate(accountName, engineName, db)
+
+	db, err = f.conns.get(ctx, accountName, engineName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconnect: %w", err)
+	}
+
+	return db.QueryContext(ctx, query, args...)
+}
+
+// sessionLostMessages are the parts of the driver's error messages, which tell that the session of the pool was lost.
+// The driver doesn't wrap its errors, so they can only be told apart by the message.
+var sessionLostMessages = []string{
+	"error while getting access token",
+	"authentication request failed",
+	"non ok status code: 401",
 }
 
-// connect returns a sql.DB instance for specified account and engine. In case engine name is not provided, it will connect
+// isSessionLost tells whether the query failed because the session of the pool was lost, so that the pool
+// needs to be opened again.
+func isSessionLost(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+
+	msg := err.Error()
+	return slices.ContainsFunc(sessionLostMessages, func(s string) bool {
+		return strings.Contains(msg, s)
+	})
+}
+
+// connect opens a sql.DB pool for specified account and engine. In case engine name is not provided, it will connect
 // to a system engine.
 func (f *fetcher) connect(ctx context.Context, accountName string, engineName string) (*sql.DB, error) {
-	dsn := fmt.Sprintf("firebolt://?account_name=%s&client_id=%s&client_secret=%s",
-		accountName, f.clientID, f.clientSecret,
-	)
+	// The engine is selected by the driver when the pool is opened, so that every connection of the pool
+	// is bound to the engine. A `USE ENGINE` statement would only switch a single connection of the pool.
+	connStr, err := dsn{
+		accountName:  accountName,
+		clientID:     f.clientID,
+		clientSecret: f.clientSecret,
+		engineName:   engineName,
+	}.build()
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection parameters: %w", err)
+	}
 
-	db, err := sql.Open("firebolt", dsn)
+	// label the queries to appear in query history
+	setQueryLabel, err := setStatement("query_label", f.queryLabel)
 	if err != nil {
 		return nil, err
 	}
 
-	// switch to the engine if engineName is provided
-	if engineName != "" {
-		// switch to an engine
-		_, err = db.ExecContext(ctx, fmt.Sprintf(`USE ENGINE "%s";`, engineName))
-		if err != nil {
-			return nil, fmt.Errorf("failed to switch to engine %s: %w", engineName, err)
-		}
+	db, err := f.openDB(ctx, connStr)
+	if err != nil {
+		return nil, err
+	}
 
+	if engineName != "" {
 		// prevent engine from auto stopping caused by exporter queries
 		_, err = db.ExecContext(ctx, `SET auto_start_stop_control=ignore;`)
 		if err != nil {
+			closePool(connKey{account: accountName, engine: engineName}, db)
 			return nil, fmt.Errorf("failed to set auto_start_stop_control = ignore for engine %s: %w", engineName, err)
 		}
 
 		// add a query label to appear in query history
-		_, err = db.ExecContext(ctx, `SET query_label=otel-exporter;`)
+		_, err = db.ExecContext(ctx, setQueryLabel)
 		if err != nil {
+			closePool(connKey{account: accountName, engine: engineName}, db)
 			return nil, fmt.Errorf("failed to set query label: %w", err)
 		}
 	}
 
 	return db, nil
 }
+
+// openDB opens a sql.DB pool with the connection string. The driver authenticates and selects the engine
+// when the pool is opened, which is done for a single pool at a time.
+func (f *fetcher) openDB(ctx context.Context, connStr string) (*sql.DB, error) {
+	if err := f.openLock.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer f.openLock.unlock()
+
+	return sql.Open("firebolt", connStr)
+}
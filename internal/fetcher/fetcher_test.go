@@ -0,0 +1,204 @@
+package fetcher
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_runtimeQuery(t *testing.T) {
+	t.Parallel()
+
+	// the latest point of each cluster
+	query := runtimeQuery(false)
+	require.Contains(t, query, "ROW_NUMBER() OVER (PARTITION BY engine_cluster ORDER BY event_time DESC)")
+	require.Contains(t, query, "WHERE rn = 1")
+	require.Contains(t, query, "event_time > TIMESTAMPTZ ? AND event_time <= TIMESTAMPTZ ?")
+
+	// all the points
+	query = runtimeQuery(true)
+	require.NotContains(t, query, "ROW_NUMBER")
+	require.Contains(t, query, "event_time > TIMESTAMPTZ ? AND event_time <= TIMESTAMPTZ ?")
+	require.Contains(t, query, "ORDER BY event_time;")
+}
+
+func Test_fetcher_FetchRuntimePoints_engineTimeout(t *testing.T) {
+	t.Parallel()
+
+	f := newFetcherMock(t, WithEngineTimeout(50*time.Millisecond))
+
+	engines := []Engine{{Name: "fast", Status: "RUNNING"}, {Name: "slow", Status: "RUNNING"}}
+	pointsCh, errCh := f.FetchRuntimePoints(context.Background(), "acct", engines, time.Now().Add(-time.Minute), time.Now())
+
+	// the slow engine doesn't hold back the data points of the other one.
+	var points []EngineRuntimePoint
+	for p := range pointsCh {
+		points = append(points, p)
+	}
+	require.Len(t, points, 1)
+	require.Equal(t, "fast", points[0].EngineName)
+
+	var errs []error
+	for err := range errCh {
+		errs = append(errs, err)
+	}
+	require.Len(t, errs, 1)
+
+	var engineErr *EngineError
+	require.ErrorAs(t, errs[0], &engineErr)
+	require.Equal(t, "slow", engineErr.EngineName)
+	require.ErrorIs(t, errs[0], context.DeadlineExceeded)
+}
+
+func Test_fetcher_FetchQueryHistoryPoints_cancelled(t *testing.T) {
+	t.Parallel()
+
+	f := newFetcherMock(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	engines := []Engine{{Name: "fast", Status: "RUNNING"}}
+	pointsCh, errCh := f.FetchQueryHistoryPoints(ctx, "acct", engines, time.Now().Add(-time.Minute), time.Now())
+
+	// the consumer stops without reading the data points, so the fetcher must not block on pushing them.
+	cancel()
+
+	var errs []error
+	for err := range errCh {
+		errs = append(errs, err)
+	}
+	require.Len(t, errs, 1)
+	require.ErrorIs(t, errs[0], context.Canceled)
+
+	_, ok := <-pointsCh
+	require.False(t, ok)
+}
+
+func Test_fetcher_queryContext_reconnect(t *testing.T) {
+	t.Parallel()
+
+	f := newFetcherMock(t)
+
+	opened := 0
+	f.conns = newConnManager(func(ctx context.Context, accountName, engineName string) (*sql.DB, error) {
+		opened++
+		return sql.OpenDB(connectorRowsMock{engineName: engineName}), nil
+	})
+
+	// a plain SQL error keeps the pool
+	_, err := f.queryContext(context.Background(), "acct", "sqlError", "SELECT 1")
+	require.ErrorContains(t, err, "syntax error")
+	_, err = f.queryContext(context.Background(), "acct", "sqlError", "SELECT 1")
+	require.ErrorContains(t, err, "syntax error")
+	require.Equal(t, 1, opened)
+
+	// a lost session makes the pool open again, and the query is retried once
+	_, err = f.queryContext(context.Background(), "acct", "sessionLost", "SELECT 1")
+	require.ErrorContains(t, err, "non ok status code: 401")
+	require.Equal(t, 3, opened)
+}
+
+func Test_isSessionLost(t *testing.T) {
+	t.Parallel()
+
+	require.True(t, isSessionLost(driver.ErrBadConn))
+	require.True(t, isSessionLost(errors.New("error during query request: error while getting access token: expired")))
+	require.True(t, isSessionLost(errors.New("request returned non ok status code: 401, unauthorized")))
+	require.False(t, isSessionLost(errors.New("syntax error at line 1")))
+	require.False(t, isSessionLost(errors.New("request returned non ok status code: 400, bad request")))
+}
+
+// newFetcherMock creates a fetcher, which connects to connectorRowsMock instead of Firebolt.
+func newFetcherMock(t *testing.T, options ...Option) *fetcher {
+	f := &fetcher{queryLabel: DefaultQueryLabel}
+	for _, opt := range options {
+		f = opt.apply(f)
+	}
+
+	f.limiter = newConnLimiter(f.maxConnections)
+	f.conns = newConnManager(func(ctx context.Context, accountName, engineName string) (*sql.DB, error) {
+		return sql.OpenDB(connectorRowsMock{engineName: engineName}), nil
+	})
+	t.Cleanup(func() { require.NoError(t, f.Close()) })
+
+	return f
+}
+
+// connectorRowsMock is a driver.Connector, which returns a single row of NULLs for any query.
+// The queries of the engine named "slow" block until their context is done, the queries of the engines named
+// "sqlError" and "sessionLost" fail.
+type connectorRowsMock struct {
+	engineName string
+}
+
+func (c connectorRowsMock) Connect(context.Context) (driver.Conn, error) {
+	return connRowsMock(c), nil
+}
+
+func (connectorRowsMock) Driver() driver.Driver {
+	return nil
+}
+
+type connRowsMock connectorRowsMock
+
+func (c connRowsMock) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	switch c.engineName {
+	case "slow":
+		<-ctx.Done()
+		return nil, ctx.Err()
+	case "sqlError":
+		return nil, errors.New("syntax error at line 1")
+	case "sessionLost":
+		return nil, errors.New("request returned non ok status code: 401, unauthorized")
+	}
+
+	// the query history query reads more columns than the runtime one.
+	if strings.Contains(query, "engine_query_history") {
+		return &rowsMock{columns: 24}, nil
+	}
+	return &rowsMock{columns: 9}, nil
+}
+
+func (connRowsMock) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (connRowsMock) Close() error {
+	return nil
+}
+
+func (connRowsMock) Begin() (driver.Tx, error) {
+	return nil, errors.New("not implemented")
+}
+
+// rowsMock is a single row of NULLs.
+type rowsMock struct {
+	columns int
+	read    bool
+}
+
+func (r *rowsMock) Columns() []string {
+	return make([]string, r.columns)
+}
+
+func (r *rowsMock) Close() error {
+	return nil
+}
+
+func (r *rowsMock) Next(dest []driver.Value) error {
+	if r.read {
+		return io.EOF
+	}
+	r.read = true
+
+	for i := range dest {
+		dest[i] = nil
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package fetcher
+
+import "context"
+
+// connLimiter limits the number of queries, which the fetcher runs concurrently, and so the number of connections
+// to Firebolt in use across all the accounts and engines.
+type connLimiter struct {
+	// slots is nil if the number of queries is not limited.
+	slots chan struct{}
+}
+
+// newConnLimiter creates a new connLimiter, which lets up to limit queries run concurrently.
+// A limit which is not positive means no limit.
+func newConnLimiter(limit int) *connLimiter {
+	if limit <= 0 {
+		return &connLimiter{}
+	}
+
+	return &connLimiter{slots: make(chan struct{}, limit)}
+}
+
+// acquire blocks until a query is allowed to run, or the context is done. Every successful acquire must be followed
+// by a release once the query is done.
+func (l *connLimiter) acquire(ctx context.Context) error {
+	if l.slots == nil {
+		return nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release lets another query run.
+func (l *connLimiter) release() {
+	if l.slots == nil {
+		return
+	}
+
+	<-l.slots
+}
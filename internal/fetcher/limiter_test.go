@@ -0,0 +1,37 @@
+package fetcher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_connLimiter(t *testing.T) {
+	t.Parallel()
+
+	l := newConnLimiter(2)
+
+	require.NoError(t, l.acquire(context.Background()))
+	require.NoError(t, l.acquire(context.Background()))
+
+	// no more slots until one is released
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, l.acquire(ctx), context.DeadlineExceeded)
+
+	l.release()
+	require.NoError(t, l.acquire(context.Background()))
+}
+
+func Test_connLimiter_unlimited(t *testing.T) {
+	t.Parallel()
+
+	l := newConnLimiter(0)
+
+	for range 100 {
+		require.NoError(t, l.acquire(context.Background()))
+	}
+	l.release()
+}
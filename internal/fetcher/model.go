@@ -2,9 +2,26 @@ package fetcher
 
 import (
 	"database/sql"
+	"fmt"
 	"time"
 )
 
+// EngineError is reported when data points of an engine could not be fetched completely.
+type EngineError struct {
+	EngineName string
+	Err        error
+}
+
+// Error returns the error message.
+func (e *EngineError) Error() string {
+	return fmt.Sprintf("engine %s: %v", e.EngineName, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *EngineError) Unwrap() error {
+	return e.Err
+}
+
 // Engine represents an engine entry, on which metrics are collected
 type Engine struct {
 	Name   string
@@ -27,8 +44,13 @@ type EngineRuntimePoint struct {
 	SuspendedQueries sql.NullInt64
 }
 
+// scanner is implemented by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
 // Scan fills in EngineRuntimePoint fields from a single row.
-func (p *EngineRuntimePoint) Scan(row *sql.Row) error {
+func (p *EngineRuntimePoint) Scan(row scanner) error {
 	return row.Scan(
 		&p.EngineCluster,
 		&p.EventTime,
@@ -47,6 +69,12 @@ type QueryHistoryPoint struct {
 	EngineName   string
 	EngineStatus string
 
+	QueryID       sql.NullString
+	SubmittedTime sql.Null[time.Time]
+	// StartTime and EndTime are the times the query started and ended executing at.
+	StartTime sql.Null[time.Time]
+	EndTime   sql.Null[time.Time]
+
 	AccountName sql.NullString
 	UserName    sql.NullString
 
@@ -62,4 +90,19 @@ type QueryHistoryPoint struct {
 	ReturnedBytes               sql.NullInt64
 	TimeInQueueMicroSeconds     sql.NullInt64
 	GatewayDurationMicroSeconds sql.NullInt64
+
+	QueryLabel sql.NullString
+	// QueryText is the text of the query as it was submitted.
+	QueryText sql.NullString
+	// ErrorMessage is the error, which the query failed with. It's empty for the queries, which didn't fail.
+	ErrorMessage sql.NullString
+	// ScannedCacheBytes and ScannedStorageBytes tell how many of the scanned bytes were read from the local cache
+	// and from the storage.
+	ScannedCacheBytes   sql.NullInt64
+	ScannedStorageBytes sql.NullInt64
+	// CPUUsageMicroSeconds is the CPU time the query used, and CPUDelayMicroSeconds is the time it waited for CPU.
+	CPUUsageMicroSeconds sql.NullInt64
+	CPUDelayMicroSeconds sql.NullInt64
+	// Exporter is true if the query was issued by the exporter itself, as told by its query label.
+	Exporter bool
 }
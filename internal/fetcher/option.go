@@ -0,0 +1,45 @@
+package fetcher
+
+import "time"
+
+type Option interface {
+	apply(fetcher *fetcher) *fetcher
+}
+
+type optionFunc func(fetcher *fetcher) *fetcher
+
+func (o optionFunc) apply(fetcher *fetcher) *fetcher {
+	return o(fetcher)
+}
+
+// WithAllRuntimeSamples makes the Fetcher read all the runtime samples within the time interval, instead of the most recent one
+func WithAllRuntimeSamples(enabled bool) Option {
+	return optionFunc(func(fetcher *fetcher) *fetcher {
+		fetcher.allRuntimeSamples = enabled
+		return fetcher
+	})
+}
+
+// WithQueryLabel makes the Fetcher label its queries with provided query label
+func WithQueryLabel(label string) Option {
+	return optionFunc(func(fetcher *fetcher) *fetcher {
+		fetcher.queryLabel = label
+		return fetcher
+	})
+}
+
+// WithEngineTimeout limits how long the Fetcher fetches the data points of a single engine
+func WithEngineTimeout(timeout time.Duration) Option {
+	return optionFunc(func(fetcher *fetcher) *fetcher {
+		fetcher.engineTimeout = timeout
+		return fetcher
+	})
+}
+
+// WithMaxConnections limits the number of queries the Fetcher runs concurrently across all the accounts and engines
+func WithMaxConnections(maxConnections int) Option {
+	return optionFunc(func(fetcher *fetcher) *fetcher {
+		fetcher.maxConnections = maxConnections
+		return fetcher
+	})
+}
@@ -0,0 +1,184 @@
+// Package slowquery tells the queries, which exceed the duration, queue time or scanned bytes thresholds of their
+// engine or user, and redacts their query texts before they are reported.
+package slowquery
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted replaces the parts of the query text, which match the redaction patterns.
+const Redacted = "?"
+
+// Reasons of a slow query, one for each threshold it exceeds.
+const (
+	ReasonDuration     = "duration"
+	ReasonQueueTime    = "queue_time"
+	ReasonScannedBytes = "scanned_bytes"
+)
+
+// Thresholds define when a query is slow. A zero threshold is not checked.
+type Thresholds struct {
+	Duration     time.Duration
+	QueueTime    time.Duration
+	ScannedBytes int64
+}
+
+// Exceeded returns the reasons the query with provided stats is slow for, or none if it's not slow.
+func (t Thresholds) Exceeded(duration, queueTime time.Duration, scannedBytes int64) []string {
+	var reasons []string
+
+	if t.Duration > 0 && duration > t.Duration {
+		reasons = append(reasons, ReasonDuration)
+	}
+	if t.QueueTime > 0 && queueTime > t.QueueTime {
+		reasons = append(reasons, ReasonQueueTime)
+	}
+	if t.ScannedBytes > 0 && scannedBytes > t.ScannedBytes {
+		reasons = append(reasons, ReasonScannedBytes)
+	}
+
+	return reasons
+}
+
+// Rules define the thresholds of each query and how its query text is redacted.
+type Rules struct {
+	// Default are the thresholds of the queries, which have no thresholds of their engine or user.
+	Default Thresholds
+	// Engines and Users are the thresholds of the queries of each engine and user. They replace the default
+	// thresholds as a whole, and the thresholds of the user take precedence over the ones of the engine.
+	Engines map[string]Thresholds
+	Users   map[string]Thresholds
+	// Redact are the patterns of the query text, which are replaced by Redacted.
+	Redact []*regexp.Regexp
+}
+
+// Thresholds returns the thresholds of the queries of provided engine and user.
+func (r Rules) Thresholds(engineName, userName string) Thresholds {
+	if t, ok := r.Users[userName]; ok {
+		return t
+	}
+	if t, ok := r.Engines[engineName]; ok {
+		return t
+	}
+
+	return r.Default
+}
+
+// RedactQuery returns the query text with the parts, which match any of the redaction patterns, replaced.
+func (r Rules) RedactQuery(queryText string) string {
+	for _, pattern := range r.Redact {
+		queryText = pattern.ReplaceAllLiteralString(queryText, Redacted)
+	}
+
+	return queryText
+}
+
+// thresholdsFile is a YAML representation of the thresholds. The durations are parsed by [time.ParseDuration].
+type thresholdsFile struct {
+	Duration     string `yaml:"duration"`
+	QueueTime    string `yaml:"queue_time"`
+	ScannedBytes int64  `yaml:"scanned_bytes"`
+}
+
+// rulesFile is a YAML representation of the rules.
+type rulesFile struct {
+	Engines map[string]thresholdsFile `yaml:"engines"`
+	Users   map[string]thresholdsFile `yaml:"users"`
+	Redact  []string                  `yaml:"redact"`
+}
+
+// LoadRules reads the thresholds of the engines and users, and the redaction patterns, from the YAML file at
+// provided path, and returns them along with provided default thresholds:
+//
+//	engines:
+//	  etl:
+//	    duration: 10m
+//	    scanned_bytes: 1000000000000
+//	users:
+//	  dashboard:
+//	    duration: 5s
+//	    queue_time: 1s
+//	redact:
+//	  - (?i)password\s*=\s*'[^']*'
+func LoadRules(path string, defaults Thresholds) (Rules, error) {
+	rules := Rules{Default: defaults}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rules, fmt.Errorf("failed to read slow query rules file: %w", err)
+	}
+
+	var rf rulesFile
+	if err := yaml.Unmarshal(data, &rf); err != nil {
+		return rules, fmt.Errorf("failed to parse slow query rules file %s: %w", path, err)
+	}
+
+	if rules.Engines, err = parseThresholds("engine", rf.Engines); err != nil {
+		return rules, err
+	}
+	if rules.Users, err = parseThresholds("user", rf.Users); err != nil {
+		return rules, err
+	}
+
+	for i, p := range rf.Redact {
+		if p == "" {
+			return rules, fmt.Errorf("redact #%d: pattern must not be empty", i+1)
+		}
+
+		pattern, err := regexp.Compile(p)
+		if err != nil {
+			return rules, fmt.Errorf("redact #%d: invalid pattern: %w", i+1, err)
+		}
+
+		rules.Redact = append(rules.Redact, pattern)
+	}
+
+	return rules, nil
+}
+
+// parseThresholds parses the thresholds of each engine or user, as told by kind.
+func parseThresholds(kind string, files map[string]thresholdsFile) (map[string]Thresholds, error) {
+	thresholds := make(map[string]Thresholds, len(files))
+
+	for name, tf := range files {
+		var t Thresholds
+		var err error
+
+		if t.Duration, err = parseDuration(tf.Duration); err != nil {
+			return nil, fmt.Errorf("%s %s: invalid duration: %w", kind, name, err)
+		}
+		if t.QueueTime, err = parseDuration(tf.QueueTime); err != nil {
+			return nil, fmt.Errorf("%s %s: invalid queue_time: %w", kind, name, err)
+		}
+		if tf.ScannedBytes < 0 {
+			return nil, fmt.Errorf("%s %s: scanned_bytes must not be negative", kind, name)
+		}
+		t.ScannedBytes = tf.ScannedBytes
+
+		thresholds[name] = t
+	}
+
+	return thresholds, nil
+}
+
+// parseDuration parses a non-negative duration. An empty value is a zero duration.
+func parseDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("must not be negative")
+	}
+
+	return d, nil
+}
@@ -0,0 +1,124 @@
+package slowquery
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Thresholds_Exceeded(t *testing.T) {
+	t.Parallel()
+
+	th := Thresholds{Duration: time.Minute, ScannedBytes: 1000}
+
+	require.Empty(t, th.Exceeded(time.Minute, time.Hour, 1000))
+	require.Equal(t, []string{ReasonDuration}, th.Exceeded(2*time.Minute, 0, 0))
+	require.Equal(t, []string{ReasonDuration, ReasonScannedBytes}, th.Exceeded(2*time.Minute, 0, 1001))
+
+	// zero thresholds are not checked
+	require.Empty(t, Thresholds{}.Exceeded(time.Hour, time.Hour, 1<<40))
+	require.Equal(t, []string{ReasonQueueTime}, Thresholds{QueueTime: time.Second}.Exceeded(0, 2*time.Second, 0))
+}
+
+func Test_Rules(t *testing.T) {
+	t.Parallel()
+
+	r := Rules{
+		Default: Thresholds{Duration: time.Minute},
+		Engines: map[string]Thresholds{"etl": {Duration: time.Hour}},
+		Users:   map[string]Thresholds{"dashboard": {Duration: time.Second}},
+		Redact: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)password\s*=\s*'[^']*'`),
+			regexp.MustCompile(`\b\d{16}\b`),
+		},
+	}
+
+	require.Equal(t, Thresholds{Duration: time.Minute}, r.Thresholds("web", "alice"))
+	require.Equal(t, Thresholds{Duration: time.Hour}, r.Thresholds("etl", "alice"))
+	require.Equal(t, Thresholds{Duration: time.Second}, r.Thresholds("etl", "dashboard"))
+
+	require.Equal(t,
+		"CREATE USER bob WITH ?; SELECT * FROM cards WHERE number = ?",
+		r.RedactQuery("CREATE USER bob WITH PASSWORD = 'secret'; SELECT * FROM cards WHERE number = 4111111111111111"),
+	)
+}
+
+func Test_LoadRules(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+engines:
+  etl:
+    duration: 10m
+    scanned_bytes: 1000000000000
+users:
+  dashboard:
+    duration: 5s
+    queue_time: 1s
+redact:
+  - (?i)password\s*=\s*'[^']*'
+`), 0o600))
+
+	defaults := Thresholds{Duration: time.Minute}
+	rules, err := LoadRules(path, defaults)
+	require.NoError(t, err)
+
+	require.Equal(t, defaults, rules.Default)
+	require.Equal(t, map[string]Thresholds{"etl": {Duration: 10 * time.Minute, ScannedBytes: 1000000000000}}, rules.Engines)
+	require.Equal(t, map[string]Thresholds{"dashboard": {Duration: 5 * time.Second, QueueTime: time.Second}}, rules.Users)
+	require.Equal(t, "ALTER USER bob SET ?", rules.RedactQuery("ALTER USER bob SET PASSWORD='secret'"))
+}
+
+func Test_LoadRules_invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		content string
+		err     string
+	}{
+		"invalid yaml": {
+			content: "engines: [",
+			err:     "failed to parse slow query rules file",
+		},
+		"invalid duration": {
+			content: "engines:\n  etl:\n    duration: 10\n",
+			err:     "engine etl: invalid duration",
+		},
+		"negative queue time": {
+			content: "users:\n  alice:\n    queue_time: -1s\n",
+			err:     "user alice: invalid queue_time: must not be negative",
+		},
+		"negative scanned bytes": {
+			content: "engines:\n  etl:\n    scanned_bytes: -1\n",
+			err:     "engine etl: scanned_bytes must not be negative",
+		},
+		"empty pattern": {
+			content: "redact:\n  - \"\"\n",
+			err:     "redact #1: pattern must not be empty",
+		},
+		"invalid pattern": {
+			content: "redact:\n  - (password\n",
+			err:     "redact #1: invalid pattern",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "rules.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o600))
+
+			_, err := LoadRules(path, Thresholds{})
+			require.ErrorContains(t, err, tt.err)
+		})
+	}
+
+	_, err := LoadRules(filepath.Join(t.TempDir(), "missing.yaml"), Thresholds{})
+	require.ErrorContains(t, err, "failed to read slow query rules file")
+}
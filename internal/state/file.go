@@ -0,0 +1,109 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// fileStore is an implementation of Store, which keeps the state in a local JSON file.
+type fileStore struct {
+	path string
+}
+
+// NewFileStore creates a new instance of Store, which keeps the state in a local file at provided path.
+func NewFileStore(path string) Store {
+	return &fileStore{path: path}
+}
+
+// fileState is a JSON representation of State.
+type fileState struct {
+	Engines []fileEngineState `json:"engines"`
+}
+
+// fileEngineState is a JSON representation of EngineState.
+type fileEngineState struct {
+	Account         string               `json:"account"`
+	Engine          string               `json:"engine"`
+	Watermark       time.Time            `json:"watermark"`
+	ReportedQueries map[string]time.Time `json:"reported_queries,omitempty"`
+}
+
+// Load reads the State from the file. It returns an empty State if the file doesn't exist.
+func (f *fileStore) Load(_ context.Context) (*State, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return New(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	var st fileState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", f.path, err)
+	}
+
+	s := New()
+	for _, es := range st.Engines {
+		reported := es.ReportedQueries
+		if reported == nil {
+			reported = make(map[string]time.Time)
+		}
+
+		s.Engines[Key{Account: es.Account, Engine: es.Engine}] = EngineState{
+			Watermark:       es.Watermark,
+			ReportedQueries: reported,
+		}
+	}
+
+	return s, nil
+}
+
+// Save writes the State to the file. The file is replaced atomically, so that it's never left half-written.
+func (f *fileStore) Save(_ context.Context, s *State) error {
+	st := fileState{
+		Engines: make([]fileEngineState, 0, len(s.Engines)),
+	}
+	for key, es := range s.Engines {
+		st.Engines = append(st.Engines, fileEngineState{
+			Account:         key.Account,
+			Engine:          key.Engine,
+			Watermark:       es.Watermark,
+			ReportedQueries: es.ReportedQueries,
+		})
+	}
+
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create state file: %w", err)
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		return errors.Join(fmt.Errorf("failed to write state file: %w", err), tmp.Close(), os.Remove(tmp.Name()))
+	}
+	// the data must reach the disk before the rename, otherwise a crash may leave an empty file in place.
+	if err := tmp.Sync(); err != nil {
+		return errors.Join(fmt.Errorf("failed to write state file: %w", err), tmp.Close(), os.Remove(tmp.Name()))
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.Join(fmt.Errorf("failed to write state file: %w", err), os.Remove(tmp.Name()))
+	}
+
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return errors.Join(fmt.Errorf("failed to replace state file: %w", err), os.Remove(tmp.Name()))
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package state_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/firebolt-db/otel-exporter/internal/state"
+)
+
+func Test_FileStore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.json")
+	store := state.NewFileStore(path)
+
+	// missing file means empty state
+	s, err := store.Load(ctx)
+	require.NoError(t, err)
+	require.Equal(t, state.New(), s)
+
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.Engines[state.Key{Account: "acct", Engine: "eng1"}] = state.EngineState{
+		Watermark:       now,
+		ReportedQueries: map[string]time.Time{"q1": now.Add(-time.Minute)},
+	}
+	s.Engines[state.Key{Account: "acct", Engine: "eng2"}] = state.EngineState{
+		Watermark:       now.Add(-time.Hour),
+		ReportedQueries: map[string]time.Time{},
+	}
+	require.NoError(t, store.Save(ctx, s))
+
+	loaded, err := state.NewFileStore(path).Load(ctx)
+	require.NoError(t, err)
+	require.Equal(t, s, loaded)
+
+	// no temporary files are left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func Test_FileStore_corrupted(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+
+	s, err := state.NewFileStore(path).Load(context.Background())
+	require.ErrorContains(t, err, "failed to parse state file")
+	require.Nil(t, s)
+}
+
+func Test_MemoryStore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := state.NewMemoryStore()
+
+	s, err := store.Load(ctx)
+	require.NoError(t, err)
+	require.Equal(t, state.New(), s)
+
+	key := state.Key{Account: "acct", Engine: "eng"}
+	s.Engines[key] = state.EngineState{Watermark: time.Now(), ReportedQueries: map[string]time.Time{}}
+	require.NoError(t, store.Save(ctx, s))
+
+	loaded, err := store.Load(ctx)
+	require.NoError(t, err)
+	require.Equal(t, s, loaded)
+
+	// saved state is not affected by further changes
+	delete(s.Engines, key)
+	loaded, err = store.Load(ctx)
+	require.NoError(t, err)
+	require.Contains(t, loaded.Engines, key)
+}
@@ -0,0 +1,91 @@
+package state
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Key identifies a single engine in an account.
+type Key struct {
+	Account string
+	Engine  string
+}
+
+// EngineState is the query history collection state of a single engine.
+type EngineState struct {
+	// Watermark is the end of the last collected query history window.
+	Watermark time.Time
+
+	// ReportedQueries maps query_id of the queries, which were already reported within the lookback window,
+	// to their submitted_time.
+	ReportedQueries map[string]time.Time
+}
+
+// State is the collection state, which is kept between the runs of the exporter.
+type State struct {
+	Engines map[Key]EngineState
+}
+
+// New creates a new empty State.
+func New() *State {
+	return &State{
+		Engines: make(map[Key]EngineState),
+	}
+}
+
+// Store is an interface that the collection state storage should implement.
+type Store interface {
+	// Load returns the last saved State. It returns an empty State if nothing was saved yet.
+	Load(ctx context.Context) (*State, error)
+
+	// Save persists provided State.
+	Save(ctx context.Context, s *State) error
+}
+
+// memoryStore is an in-memory implementation of Store. The state is lost when the exporter is restarted.
+type memoryStore struct {
+	mu    sync.Mutex
+	state *State
+}
+
+// NewMemoryStore creates a new instance of in-memory Store.
+func NewMemoryStore() Store {
+	return &memoryStore{}
+}
+
+// Load returns the last saved State.
+func (m *memoryStore) Load(_ context.Context) (*State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.state == nil {
+		return New(), nil
+	}
+
+	return clone(m.state), nil
+}
+
+// Save keeps a copy of provided State in memory.
+func (m *memoryStore) Save(_ context.Context, s *State) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state = clone(s)
+	return nil
+}
+
+// clone returns a deep copy of the State.
+func clone(s *State) *State {
+	c := New()
+	for key, es := range s.Engines {
+		reported := make(map[string]time.Time, len(es.ReportedQueries))
+		for queryID, submittedTime := range es.ReportedQueries {
+			reported[queryID] = submittedTime
+		}
+
+		c.Engines[key] = EngineState{Watermark: es.Watermark, ReportedQueries: reported}
+	}
+
+	return c
+}